@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func runApply(args []string, _ BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("apply")
+	file := flags.String("f", "", "file with the changes to apply in the webhook's JSON format, '-' reads from stdin")
+	dryRun := flags.Bool("dry-run", false, "only log the changes that would be made")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("the changes file must be set with -f")
+	}
+
+	changes, err := readChanges(*file)
+	if err != nil {
+		return err
+	}
+
+	var options []dnsprovider.Option
+	if *dryRun {
+		options = append(options, dnsprovider.WithDryRun())
+	}
+
+	provider, err := dnsprovider.Init(configuration.Init(), options...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+	defer provider.Close()
+
+	log.Infof("applying changes, create: %d, updateOld: %d, updateNew: %d, delete: %d",
+		len(changes.Create), len(changes.UpdateOld), len(changes.UpdateNew), len(changes.Delete))
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		return fmt.Errorf("failed to apply changes: %w", err)
+	}
+	fmt.Fprintln(stdout, "changes applied")
+	return nil
+}
+
+// readChanges decodes the plan changes from the given file, or from stdin for '-'
+func readChanges(file string) (*plan.Changes, error) {
+	var reader io.Reader
+	if file == "-" {
+		reader = os.Stdin
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open changes file: %w", err)
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	changes := &plan.Changes{}
+	if err := json.NewDecoder(reader).Decode(changes); err != nil {
+		return nil, fmt.Errorf("error decoding changes: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// BuildInfo identifies the running binary, it is set at build time
+type BuildInfo struct {
+	Version string
+	Gitsha  string
+}
+
+// command is a single subcommand of the webhook binary
+type command struct {
+	description string
+	run         func(args []string, info BuildInfo, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"serve": {
+		description: "start the webhook server (default)",
+		run:         runServe,
+	},
+	"records": {
+		description: "list the current records as endpoints",
+		run:         runRecords,
+	},
+	"apply": {
+		description: "apply a plan of changes read from a file",
+		run:         runApply,
+	},
+	"export": {
+		description: "export zones as RFC 1035 zone files",
+		run:         runExport,
+	},
+	"import": {
+		description: "import an RFC 1035 zone file into a zone",
+		run:         runImport,
+	},
+	"validate": {
+		description: "check the configuration and the Anexia credentials",
+		run:         runValidate,
+	},
+}
+
+// Run dispatches the given command line arguments to the matching subcommand.
+// Without any arguments the webhook server is started, so existing deployments keep working.
+func Run(args []string, info BuildInfo) error {
+	if len(args) == 0 {
+		return runServe(args, info, os.Stdout)
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command '%s'", name)
+	}
+	err := cmd.run(args[1:], info, os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		// the flag set printed the usage of the command already
+		return nil
+	}
+	return err
+}
+
+func printUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(w, "\nUse '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestRunUnknownCommand(t *testing.T) {
+	err := Run([]string{"unknown"}, BuildInfo{})
+	assert.EqualError(t, err, "unknown command 'unknown'")
+}
+
+func TestRunHelp(t *testing.T) {
+	for _, name := range []string{"serve", "records", "apply", "export", "import", "validate"} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, Run([]string{name, "-h"}, BuildInfo{}))
+		})
+	}
+}
+
+func TestRunChecksFlagsBeforeCreatingProvider(t *testing.T) {
+	err := Run([]string{"records", "-o", "xml"}, BuildInfo{})
+	assert.EqualError(t, err, "unsupported output format 'xml'")
+
+	err = Run([]string{"export", "-d", filepath.Join(t.TempDir(), "missing")}, BuildInfo{})
+	assert.ErrorContains(t, err, "missing does not exist")
+}
+
+func TestWriteEndpoints(t *testing.T) {
+	endpoints := []*endpoint.Endpoint{
+		{
+			DNSName:    "a.example.com",
+			RecordType: "A",
+			RecordTTL:  300,
+			Targets:    []string{"1.2.3.4", "5.6.7.8"},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		format        string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:   "json",
+			format: "json",
+			expected: `[
+  {
+    "dnsName": "a.example.com",
+    "targets": [
+      "1.2.3.4",
+      "5.6.7.8"
+    ],
+    "recordType": "A",
+    "recordTTL": 300
+  }
+]
+`,
+		},
+		{
+			name:   "yaml",
+			format: "yaml",
+			expected: `- dnsName: a.example.com
+  recordTTL: 300
+  recordType: A
+  targets:
+  - 1.2.3.4
+  - 5.6.7.8
+`,
+		},
+		{
+			name:   "table",
+			format: "table",
+			expected: `NAME           TYPE  TTL  TARGETS
+a.example.com  A     300  1.2.3.4,5.6.7.8
+`,
+		},
+		{
+			name:          "unsupported format",
+			format:        "xml",
+			expectedError: "unsupported output format 'xml'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := writeEndpoints(out, endpoints, tc.format)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func TestReadChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "changes.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"Create":[{"dnsName":"a.example.com","targets":["1.2.3.4"],"recordType":"A"}]}`), 0o600))
+
+	changes, err := readChanges(file)
+	require.NoError(t, err)
+	assert.Equal(t, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "a.example.com", Targets: []string{"1.2.3.4"}, RecordType: "A"},
+		},
+	}, changes)
+
+	_, err = readChanges(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{`), 0o600))
+	_, err = readChanges(invalid)
+	assert.ErrorContains(t, err, "error decoding changes")
+}
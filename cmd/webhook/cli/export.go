@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+	log "github.com/sirupsen/logrus"
+)
+
+func runExport(args []string, _ BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("export")
+	zones := flags.String("zones", "", "comma separated list of zones to export, all zones if empty")
+	dir := flags.String("d", "", "directory to write one '<zone>.zone' file per zone to, instead of writing all zones to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dir != "" {
+		if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("the output directory %s does not exist", *dir)
+		}
+	}
+
+	provider, err := dnsprovider.Init(configuration.Init(), dnsprovider.WithoutStateStore())
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+	defer provider.Close()
+
+	ctx := context.Background()
+	zoneNames := splitList(*zones)
+	if *dir == "" {
+		return provider.ExportZones(ctx, stdout, zoneNames...)
+	}
+
+	if len(zoneNames) == 0 {
+		if zoneNames, err = provider.Validate(ctx); err != nil {
+			return err
+		}
+	}
+	for _, zoneName := range zoneNames {
+		buf := &bytes.Buffer{}
+		if err := provider.ExportZones(ctx, buf, zoneName); err != nil {
+			return err
+		}
+		file := filepath.Join(*dir, strings.TrimSuffix(zoneName, ".")+".zone")
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("failed to write zone file: %w", err)
+		}
+		log.Infof("exported zone %s to %s", zoneName, file)
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, ignoring empty entries
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
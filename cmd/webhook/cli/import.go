@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/anexia"
+)
+
+func runImport(args []string, _ BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("import")
+	zone := flags.String("zone", "", "name of the zone to import the records into")
+	file := flags.String("f", "", "RFC 1035 zone file to import, '-' reads from stdin")
+	dryRun := flags.Bool("dry-run", false, "only print the changes that would be made")
+	noDelete := flags.Bool("no-delete", false, "keep records of the zone which are missing in the zone file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *zone == "" || *file == "" {
+		return errors.New("the zone must be set with -zone and the zone file with -f")
+	}
+
+	var reader io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("failed to open zone file: %w", err)
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	provider, err := dnsprovider.Init(configuration.Init())
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+	defer provider.Close()
+
+	result, err := provider.ImportZone(context.Background(), *zone, reader, anexia.ImportOptions{
+		DryRun:   *dryRun,
+		NoDelete: *noDelete,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import zone: %w", err)
+	}
+	_, err = result.WriteTo(stdout)
+	return err
+}
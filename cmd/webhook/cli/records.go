@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputFormatJSON  = "json"
+	outputFormatYAML  = "yaml"
+	outputFormatTable = "table"
+)
+
+func runRecords(args []string, _ BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("records")
+	output := flags.String("o", outputFormatTable, "output format, one of: json, yaml, table")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+
+	provider, err := dnsprovider.Init(configuration.Init(), dnsprovider.WithoutStateStore())
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+	defer provider.Close()
+
+	endpoints, err := provider.Records(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get records: %w", err)
+	}
+	return writeEndpoints(stdout, endpoints, *output)
+}
+
+// checkOutputFormat fails for output formats writeEndpoints does not support
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputFormatJSON, outputFormatYAML, outputFormatTable:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
+
+// writeEndpoints renders the endpoints in the given output format
+func writeEndpoints(w io.Writer, endpoints []*endpoint.Endpoint, format string) error {
+	switch format {
+	case outputFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(endpoints)
+	case outputFormatYAML:
+		out, err := yaml.Marshal(endpoints)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case outputFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tTTL\tTARGETS")
+		for _, ep := range endpoints {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", ep.DNSName, ep.RecordType, ep.RecordTTL, strings.Join(ep.Targets, ","))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
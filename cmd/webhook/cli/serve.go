@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/server"
+	"github.com/probstenhias/external-dns-anexia-webhook/pkg/webhook"
+)
+
+const banner = `
+    _    _   _ _______  _____    _
+   / \  | \ | | ____\ \/ /_ _|  / \
+  / _ \ |  \| |  _|  \  / | |  / _ \
+ / ___ \| |\  | |___ /  \ | | / ___ \
+/_/   \_\_| \_|_____/_/\_\___/_/   \_\
+external-dns-anexia-webhook
+version: %s (%s)
+
+`
+
+func runServe(args []string, info BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("serve")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, banner, info.Version, info.Gitsha)
+
+	config := configuration.Init()
+	provider, err := dnsprovider.Init(config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+	defer provider.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider.StartDriftDetection(ctx)
+	provider.StartHealthChecks(ctx)
+
+	srv := server.Init(config, webhook.New(provider))
+	server.ShutdownGracefully(srv)
+	return nil
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/dnsprovider"
+)
+
+func runValidate(args []string, _ BuildInfo, stdout io.Writer) error {
+	flags := newFlagSet("validate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	provider, err := dnsprovider.Init(configuration.Init(), dnsprovider.WithoutStateStore())
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	defer provider.Close()
+
+	zoneNames, err := provider.Validate(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to access the Anexia DNS API: %w", err)
+	}
+	fmt.Fprintf(stdout, "configuration is valid, %d zones accessible", len(zoneNames))
+	if len(zoneNames) > 0 {
+		fmt.Fprintf(stdout, ": %s", strings.Join(zoneNames, ", "))
+	}
+	fmt.Fprintln(stdout)
+	return nil
+}
@@ -9,12 +9,30 @@ import (
 	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
 	"github.com/probstenhias/external-dns-anexia-webhook/internal/anexia"
 	"sigs.k8s.io/external-dns/endpoint"
-	"sigs.k8s.io/external-dns/provider"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func Init(config configuration.Config) (provider.Provider, error) {
+// Option adjusts the anexia configuration read from the environment
+type Option func(*anexia.Configuration)
+
+// WithDryRun only logs the changes instead of applying them, regardless of DRY_RUN
+func WithDryRun() Option {
+	return func(c *anexia.Configuration) {
+		c.DryRun = true
+	}
+}
+
+// WithoutStateStore does not open the state store, so read-only commands neither block on nor fail against the lock
+// of a running server. Drift detection keeps its state in the store, so it is disabled as well.
+func WithoutStateStore() Option {
+	return func(c *anexia.Configuration) {
+		c.StateStore = ""
+		c.DriftDetectionInterval = 0
+	}
+}
+
+func Init(config configuration.Config, options ...Option) (*anexia.Provider, error) {
 	var domainFilter endpoint.DomainFilter
 	createMsg := "Creating anexia provider with "
 
@@ -47,6 +65,9 @@ func Init(config configuration.Config) (provider.Provider, error) {
 	if err := env.Parse(&anexiaConfig); err != nil {
 		return nil, fmt.Errorf("reading anexia configuration failed: %v", err)
 	}
+	for _, option := range options {
+		option(&anexiaConfig)
+	}
 
 	return anexia.NewProvider(&anexiaConfig, domainFilter)
 }
@@ -1,11 +1,13 @@
 package dnsprovider
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInit(t *testing.T) {
@@ -14,6 +16,7 @@ func TestInit(t *testing.T) {
 	cases := []struct {
 		name          string
 		config        configuration.Config
+		options       []Option
 		env           map[string]string
 		expectedError string
 	}{
@@ -34,6 +37,14 @@ func TestInit(t *testing.T) {
 				"ANEXIA_API_TOKEN": "token",
 			},
 		},
+		{
+			name:    "dry run option without DRY_RUN",
+			config:  configuration.Config{},
+			options: []Option{WithDryRun()},
+			env: map[string]string{
+				"ANEXIA_API_TOKEN": "token",
+			},
+		},
 		{
 			name:          "empty configuration",
 			config:        configuration.Config{},
@@ -47,7 +58,7 @@ func TestInit(t *testing.T) {
 				t.Setenv(k, v)
 			}
 
-			dnsProvider, err := Init(tc.config)
+			dnsProvider, err := Init(tc.config, tc.options...)
 
 			if tc.expectedError != "" {
 				assert.EqualError(t, err, tc.expectedError, "expecting error")
@@ -59,3 +70,16 @@ func TestInit(t *testing.T) {
 		})
 	}
 }
+
+func TestInitWithoutStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	t.Setenv("ANEXIA_API_TOKEN", "token")
+	t.Setenv("STATE_STORE", "bolt")
+	t.Setenv("STATE_STORE_PATH", path)
+	t.Setenv("DRIFT_DETECTION_INTERVAL", "5m")
+
+	dnsProvider, err := Init(configuration.Config{}, WithoutStateStore())
+	require.NoError(t, err)
+	require.NoError(t, dnsProvider.Close())
+	assert.NoFileExists(t, path, "the state store is not opened")
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	log "github.com/sirupsen/logrus"
 
@@ -25,6 +26,10 @@ import (
 // - /records (GET): returns the current records
 // - /records (POST): applies the changes
 // - /adjustendpoints (POST): executes the AdjustEndpoints method
+// - /admin/zones/export (GET): exports the zones as RFC 1035 zone files
+// - /admin/drift (GET): returns the result of the last drift check
+// - /admin/zones/resolve (GET): explains in which zone the records of a name are published
+// - /metrics (GET): exposes the prometheus metrics
 func Init(config configuration.Config, p *webhook.Webhook) *http.Server {
 	r := chi.NewRouter()
 	r.Use(webhook.Health)
@@ -32,6 +37,10 @@ func Init(config configuration.Config, p *webhook.Webhook) *http.Server {
 	r.Get("/records", p.Records)
 	r.Post("/records", p.ApplyChanges)
 	r.Post("/adjustendpoints", p.AdjustEndpoints)
+	r.Get("/admin/zones/export", p.ExportZones)
+	r.Get("/admin/drift", p.DriftReport)
+	r.Get("/admin/zones/resolve", p.ResolveZone)
+	r.Handle("/metrics", promhttp.Handler())
 
 	srv := createHTTPServer(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort), r, config.ServerReadTimeout, config.ServerWriteTimeout)
 	go func() {
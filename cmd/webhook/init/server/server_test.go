@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/probstenhias/external-dns-anexia-webhook/cmd/webhook/init/configuration"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/anexia"
 	"github.com/probstenhias/external-dns-anexia-webhook/pkg/webhook"
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/external-dns/endpoint"
@@ -22,6 +23,10 @@ type testCase struct {
 	returnRecords             []*endpoint.Endpoint
 	returnAdjustedEndpoints   []*endpoint.Endpoint
 	returnDomainFilter        endpoint.DomainFilter
+	returnZoneFile            string
+	returnDriftReport         any
+	returnDriftDisabled       bool
+	returnZoneResolution      any
 	hasError                  error
 	method                    string
 	path                      string
@@ -32,6 +37,8 @@ type testCase struct {
 	expectedBody              string
 	expectedChanges           *plan.Changes
 	expectedEndpointsToAdjust []*endpoint.Endpoint
+	expectedZoneNames         []string
+	expectedName              string
 	log.Ext1FieldLogger
 }
 
@@ -465,6 +472,134 @@ func TestNegotiate(t *testing.T) {
 	executeTestCases(t, testCases)
 }
 
+func TestExportZones(t *testing.T) {
+	testCases := []testCase{
+		{
+			name:               "all zones",
+			returnZoneFile:     "$ORIGIN a.de.",
+			method:             http.MethodGet,
+			path:               "/admin/zones/export",
+			expectedStatusCode: http.StatusOK,
+			expectedResponseHeaders: map[string]string{
+				"Content-Type": "text/dns",
+			},
+			expectedBody: "$ORIGIN a.de.",
+		},
+		{
+			name:               "selected zones",
+			returnZoneFile:     "$ORIGIN a.de.",
+			method:             http.MethodGet,
+			path:               "/admin/zones/export?zone=a.de&zone=b.de",
+			expectedStatusCode: http.StatusOK,
+			expectedZoneNames:  []string{"a.de", "b.de"},
+			expectedBody:       "$ORIGIN a.de.",
+		},
+		{
+			name:               "backend error",
+			hasError:           fmt.Errorf("zone 'c.de' not found"),
+			method:             http.MethodGet,
+			path:               "/admin/zones/export?zone=c.de",
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedResponseHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedZoneNames: []string{"c.de"},
+			expectedBody:      "error exporting zones: zone 'c.de' not found",
+		},
+	}
+
+	executeTestCases(t, testCases)
+}
+
+func TestDriftReport(t *testing.T) {
+	testCases := []testCase{
+		{
+			name:               "last report",
+			returnDriftReport:  map[string]any{"drifts": []string{}},
+			method:             http.MethodGet,
+			path:               "/admin/drift",
+			expectedStatusCode: http.StatusOK,
+			expectedResponseHeaders: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expectedBody: `{"drifts":[]}`,
+		},
+		{
+			name:               "no check yet",
+			method:             http.MethodGet,
+			path:               "/admin/drift",
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       "no drift check has run yet",
+		},
+		{
+			name:                "drift detection disabled",
+			returnDriftDisabled: true,
+			method:              http.MethodGet,
+			path:                "/admin/drift",
+			expectedStatusCode:  http.StatusNotFound,
+			expectedBody:        "drift detection is not enabled",
+		},
+	}
+
+	executeTestCases(t, testCases)
+}
+
+func TestResolveZone(t *testing.T) {
+	testCases := []testCase{
+		{
+			name:                 "zone found",
+			returnZoneResolution: map[string]any{"name": "app.a.de", "zone": "a.de"},
+			method:               http.MethodGet,
+			path:                 "/admin/zones/resolve?name=app.a.de",
+			expectedStatusCode:   http.StatusOK,
+			expectedResponseHeaders: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expectedName: "app.a.de",
+			expectedBody: `{"name":"app.a.de","zone":"a.de"}`,
+		},
+		{
+			name:                 "no zone found",
+			returnZoneResolution: map[string]any{"name": "app.c.de", "reason": "no zone found for the name"},
+			method:               http.MethodGet,
+			path:                 "/admin/zones/resolve?name=app.c.de",
+			expectedStatusCode:   http.StatusOK,
+			expectedName:         "app.c.de",
+			expectedBody:         `{"name":"app.c.de","reason":"no zone found for the name"}`,
+		},
+		{
+			name:               "missing name",
+			method:             http.MethodGet,
+			path:               "/admin/zones/resolve",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponseHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "the query parameter 'name' is missing",
+		},
+		{
+			name:               "invalid name",
+			hasError:           fmt.Errorf("%w '-app.a.de'", anexia.ErrInvalidName),
+			method:             http.MethodGet,
+			path:               "/admin/zones/resolve?name=-app.a.de",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedName:       "-app.a.de",
+			expectedBody:       "invalid domain name '-app.a.de'",
+		},
+		{
+			name:               "backend error",
+			hasError:           fmt.Errorf("unauthorized"),
+			method:             http.MethodGet,
+			path:               "/admin/zones/resolve?name=app.a.de",
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedName:       "app.a.de",
+			expectedBody:       "error resolving the zone of app.a.de: unauthorized",
+		},
+	}
+
+	executeTestCases(t, testCases)
+}
+
 func executeTestCases(t *testing.T, testCases []testCase) {
 	log.SetLevel(log.DebugLevel)
 
@@ -540,6 +675,28 @@ func (d *MockProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpo
 	return d.testCase.returnAdjustedEndpoints, nil
 }
 
+func (d *MockProvider) ExportZones(_ context.Context, w io.Writer, zoneNames ...string) error {
+	if !reflect.DeepEqual(zoneNames, d.testCase.expectedZoneNames) {
+		d.t.Errorf("expected zone names '%v', got '%v'", d.testCase.expectedZoneNames, zoneNames)
+	}
+	if d.testCase.hasError != nil {
+		return d.testCase.hasError
+	}
+	_, err := fmt.Fprint(w, d.testCase.returnZoneFile)
+	return err
+}
+
+func (d *MockProvider) DriftReport() (any, bool) {
+	return d.testCase.returnDriftReport, !d.testCase.returnDriftDisabled
+}
+
+func (d *MockProvider) ResolveZone(_ context.Context, name string) (any, error) {
+	if name != d.testCase.expectedName {
+		d.t.Errorf("expected name '%s', got '%s'", d.testCase.expectedName, name)
+	}
+	return d.testCase.returnZoneResolution, d.testCase.hasError
+}
+
 func (d *MockProvider) GetDomainFilter() endpoint.DomainFilter {
 	return d.testCase.returnDomainFilter
 }
@@ -1,6 +1,8 @@
 package anexia
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v11"
 	log "github.com/sirupsen/logrus"
 )
@@ -10,6 +12,50 @@ type Configuration struct {
 	APIToken       string `env:"ANEXIA_API_TOKEN,notEmpty"`
 	APIEndpointURL string `env:"ANEXIA_API_URL"`
 	DryRun         bool   `env:"DRY_RUN" envDefault:"false"`
+
+	// DriftDetectionInterval enables the periodic comparison of the last applied endpoints with the records at Anexia
+	DriftDetectionInterval time.Duration `env:"DRIFT_DETECTION_INTERVAL" envDefault:"0s"`
+	// DriftRepair re-applies drifted records, otherwise drift is only reported
+	DriftRepair bool `env:"DRIFT_REPAIR" envDefault:"false"`
+
+	// StateStore enables keeping track of the created records, it is one of 'bolt' or 'memory'
+	StateStore string `env:"STATE_STORE"`
+	// StateStorePath is the file of the bolt store, it has no default as it has to be on a persistent volume
+	StateStorePath string `env:"STATE_STORE_PATH"`
+
+	// TTLPolicyFile is a YAML file with default TTLs and TTL bounds per zone and record type
+	TTLPolicyFile string `env:"TTL_POLICY_FILE"`
+
+	// ManagedRecordTypes limits the record types which are managed, by default all supported record types are managed
+	ManagedRecordTypes []string `env:"MANAGED_RECORD_TYPES" envSeparator:","`
+	// ManageApexNSSOA manages the apex NS records and reports the SOA records, which Anexia maintains for the zone
+	ManageApexNSSOA bool `env:"MANAGE_APEX_NS_SOA" envDefault:"false"`
+
+	// RewriteRulesFile is a YAML file with rules which rewrite the names of external-dns to the names at Anexia
+	RewriteRulesFile string `env:"REWRITE_RULES_FILE"`
+
+	// ZoneMappingFile is a YAML file mapping name patterns to the zones their records are published in
+	ZoneMappingFile string `env:"ZONE_MAPPING_FILE"`
+
+	// PTRCIDRs enables the management of PTR records for A and AAAA records with addresses in these networks
+	PTRCIDRs []string `env:"PTR_CIDRS" envSeparator:","`
+	// PTRConflictPolicy decides about addresses which already point at another name, it is one of 'skip' or 'overwrite'
+	PTRConflictPolicy string `env:"PTR_CONFLICT_POLICY" envDefault:"skip"`
+
+	// CNAMEFlattening publishes CNAME endpoints at the apex of a zone as the A and AAAA records of their target
+	CNAMEFlattening bool `env:"CNAME_FLATTENING" envDefault:"false"`
+	// CNAMEFlatteningResolver is the nameserver resolving the targets, by default the first one of /etc/resolv.conf
+	CNAMEFlatteningResolver string `env:"CNAME_FLATTENING_RESOLVER"`
+	// CNAMEFlatteningInterval is how long resolved addresses are reused, zero resolves the targets on every sync
+	CNAMEFlatteningInterval time.Duration `env:"CNAME_FLATTENING_INTERVAL" envDefault:"0s"`
+
+	// HealthCheckInterval enables the health checks of the targets of endpoints which configure one
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"0s"`
+	HealthCheckTimeout  time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"5s"`
+	// HealthCheckHealthyThreshold and HealthCheckUnhealthyThreshold are the numbers of consecutive results after
+	// which a target changes its health, so flapping targets are not published and withheld on every check
+	HealthCheckHealthyThreshold   int `env:"HEALTH_CHECK_HEALTHY_THRESHOLD" envDefault:"2"`
+	HealthCheckUnhealthyThreshold int `env:"HEALTH_CHECK_UNHEALTHY_THRESHOLD" envDefault:"3"`
 }
 
 // Init sets up configuration by reading set environmental variables
@@ -0,0 +1,155 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// reasons of CNAME conflicts, used as metric label
+const (
+	cnameConflictApex        = "apex"
+	cnameConflictCoexistence = "coexistence"
+	cnameConflictMultiple    = "multiple"
+)
+
+// cnameConflict describes why an endpoint can not be created
+type cnameConflict struct {
+	reason  string
+	message string
+}
+
+// withoutCNAMEConflicts checks the records to create against the zone contents after the planned deletes and creates.
+// It drops all records of an endpoint which would put a CNAME at the apex, a CNAME next to other records or a second
+// CNAME at one name and region, and counts the conflict by its reason. An old CNAME or address record which such an
+// update would replace is taken off the deletes, so the name keeps resolving to its previous target.
+func (p *Provider) withoutCNAMEConflicts(ctx context.Context, snapshot *zoneSnapshot, recordsToDelete, recordsToCreate []*anxcloudDns.Record,
+	recordSources map[*anxcloudDns.Record]*endpoint.Endpoint) ([]*anxcloudDns.Record, []*anxcloudDns.Record, error) {
+	if len(recordsToCreate) == 0 {
+		return recordsToDelete, recordsToCreate, nil
+	}
+
+	deleted := make(map[string]bool, len(recordsToDelete))
+	for _, record := range recordsToDelete {
+		deleted[record.ZoneName+"|"+record.Identifier] = true
+	}
+
+	// the records by name as they will be after the changes are applied
+	recordsByName := make(map[string][]*anxcloudDns.Record)
+	checkedZones := make(map[string]bool)
+	for _, record := range recordsToCreate {
+		if checkedZones[record.ZoneName] {
+			continue
+		}
+		checkedZones[record.ZoneName] = true
+		current, err := snapshot.zoneRecords(ctx, record.ZoneName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get records of zone %s for the CNAME conflict check: %w", record.ZoneName, err)
+		}
+		for _, currentRecord := range current {
+			if deleted[record.ZoneName+"|"+currentRecord.Identifier] {
+				continue
+			}
+			key := recordSetKey(record.ZoneName, currentRecord)
+			recordsByName[key] = append(recordsByName[key], currentRecord)
+		}
+	}
+	for _, record := range recordsToCreate {
+		key := recordSetKey(record.ZoneName, record)
+		recordsByName[key] = append(recordsByName[key], record)
+	}
+
+	conflicts := make(map[*endpoint.Endpoint]cnameConflict)
+	for _, record := range recordsToCreate {
+		ep := recordSources[record]
+		if _, found := conflicts[ep]; found {
+			continue
+		}
+		if conflict, found := findCNAMEConflict(record, recordsByName[recordSetKey(record.ZoneName, record)]); found {
+			log.Errorf("skipping creation of %s record %s, CNAME conflict: %s", ep.RecordType, ep.DNSName, conflict.message)
+			cnameConflictsCounter.WithLabelValues(conflict.reason).Inc()
+			conflicts[ep] = conflict
+		}
+	}
+	if len(conflicts) == 0 {
+		return recordsToDelete, recordsToCreate, nil
+	}
+
+	remaining := make([]*anxcloudDns.Record, 0, len(recordsToCreate))
+	refused := make([]*anxcloudDns.Record, 0, len(conflicts))
+	for _, record := range recordsToCreate {
+		if _, found := conflicts[recordSources[record]]; found {
+			refused = append(refused, record)
+			continue
+		}
+		remaining = append(remaining, record)
+	}
+	return keepReplacedRecords(recordsToDelete, refused), remaining, nil
+}
+
+// findCNAMEConflict checks a record to create against all records at its name, including itself
+func findCNAMEConflict(record *anxcloudDns.Record, recordsAtName []*anxcloudDns.Record) (cnameConflict, bool) {
+	isCNAME := strings.EqualFold(record.Type, endpoint.RecordTypeCNAME)
+	if isCNAME && isApexRecordName(record.Name) {
+		return cnameConflict{
+			reason:  cnameConflictApex,
+			message: fmt.Sprintf("a CNAME record is not allowed at the apex of zone %s", record.ZoneName),
+		}, true
+	}
+
+	cnameTargets := make(map[string]bool)
+	otherTypes := make(map[string]bool)
+	for _, other := range recordsAtName {
+		if strings.EqualFold(other.Type, endpoint.RecordTypeCNAME) {
+			cnameTargets[canonicalRData(endpoint.RecordTypeCNAME, other.RData)] = true
+		} else {
+			otherTypes[strings.ToUpper(other.Type)] = true
+		}
+	}
+
+	switch {
+	case isCNAME && len(otherTypes) > 0:
+		return cnameConflict{
+			reason:  cnameConflictCoexistence,
+			message: fmt.Sprintf("a CNAME record can not coexist with the %s records at the same name", joinSorted(otherTypes)),
+		}, true
+	case isCNAME && len(cnameTargets) > 1:
+		return cnameConflict{
+			reason:  cnameConflictMultiple,
+			message: fmt.Sprintf("there would be %d CNAME records with different targets at the same name", len(cnameTargets)),
+		}, true
+	case !isCNAME && len(cnameTargets) > 0:
+		return cnameConflict{
+			reason:  cnameConflictCoexistence,
+			message: fmt.Sprintf("a %s record can not coexist with the CNAME record at the same name", strings.ToUpper(record.Type)),
+		}, true
+	}
+	return cnameConflict{}, false
+}
+
+// recordNameKey identifies a name within a zone, independent of the spelling of the apex and of the case
+func recordNameKey(zoneName, name string) string {
+	if isApexRecordName(name) {
+		name = apexRecordName
+	}
+	return normalizeDomainName(zoneName) + "|" + strings.ToLower(name)
+}
+
+// recordSetKey identifies the records answering for a name in one region, records of different regions do not conflict
+func recordSetKey(zoneName string, record *anxcloudDns.Record) string {
+	return recordNameKey(zoneName, record.Name) + "|" + strings.ToLower(strings.TrimSpace(record.Region))
+}
+
+func joinSorted(set map[string]bool) string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
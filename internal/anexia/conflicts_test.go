@@ -0,0 +1,152 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestCNAMEConflicts(t *testing.T) {
+	zoneName := "a.de"
+	testCases := []struct {
+		name                  string
+		givenRecords          []*anxcloudDns.Record
+		whenChanges           *plan.Changes
+		expectedCreatedTypes  []string
+		expectedDeletedRecord []string
+	}{
+		{
+			name: "CNAME next to an existing A record",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "A", RData: "1.1.1.1", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "other.de"),
+					endpoint.NewEndpointWithTTL("api.a.de", "A", 300, "2.2.2.2"),
+				},
+			},
+			expectedCreatedTypes: []string{"api A"},
+		},
+		{
+			name: "CNAME replacing an A record which is deleted",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "A", RData: "1.1.1.1", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "1.1.1.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "other.de")},
+			},
+			expectedCreatedTypes:  []string{"www CNAME"},
+			expectedDeletedRecord: []string{"1"},
+		},
+		{
+			name: "CNAME at the apex",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "CNAME", 300, "other.de")},
+			},
+			expectedCreatedTypes: []string{},
+		},
+		{
+			name: "second CNAME with a different target",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "CNAME", RData: "one.de", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "two.de")},
+			},
+			expectedCreatedTypes: []string{},
+		},
+		{
+			name: "CNAME endpoint with multiple targets",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "one.de", "two.de")},
+			},
+			expectedCreatedTypes: []string{},
+		},
+		{
+			name: "CNAME with the same target as the existing one",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "CNAME", RData: "one.de.", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "One.de")},
+			},
+			// not a conflict, the existing record is kept instead of creating a duplicate
+			expectedCreatedTypes: []string{},
+		},
+		{
+			name: "A record next to an existing CNAME",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "WWW", Type: "CNAME", RData: "one.de", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "1.1.1.1")},
+			},
+			expectedCreatedTypes: []string{},
+		},
+		{
+			name: "CNAME and TXT planned at the same name",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "one.de"),
+					endpoint.NewEndpointWithTTL("www.a.de", "TXT", 300, "heritage=external-dns"),
+					endpoint.NewEndpointWithTTL("cname-www.a.de", "TXT", 300, "heritage=external-dns"),
+				},
+			},
+			expectedCreatedTypes: []string{"cname-www TXT"},
+		},
+		{
+			name: "records at other names do not conflict",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "@", Type: "A", RData: "1.1.1.1", TTL: 300},
+				{Identifier: "2", Name: "other", Type: "CNAME", RData: "one.de", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "one.de"),
+					endpoint.NewEndpointWithTTL("a.de", "MX", 300, "10 mail.a.de"),
+				},
+			},
+			expectedCreatedTypes: []string{"www CNAME", "@ MX"},
+		},
+		{
+			name: "update of a CNAME whose new record conflicts keeps the old record",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "CNAME", RData: "one.de", TTL: 300},
+				{Identifier: "2", Name: "www", Type: "TXT", RData: "\"owner\"", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "one.de")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "two.de")},
+			},
+			expectedCreatedTypes: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, record := range tc.givenRecords {
+				record.ZoneName = zoneName
+			}
+			mockDNSClient := &mockDNSClient{
+				allZones:    createZoneSlice(1, func(_ int) string { return zoneName }),
+				zoneRecords: map[string][]*anxcloudDns.Record{zoneName: tc.givenRecords},
+			}
+			provider := &Provider{client: mockDNSClient}
+			require.NoError(t, provider.ApplyChanges(context.Background(), tc.whenChanges))
+
+			createdTypes := make([]string, 0)
+			for _, record := range mockDNSClient.createdRecords[zoneName] {
+				createdTypes = append(createdTypes, record.Name+" "+record.Type)
+			}
+			assert.Equal(t, tc.expectedCreatedTypes, createdTypes)
+			assert.ElementsMatch(t, tc.expectedDeletedRecord, mockDNSClient.deletedRecords[zoneName])
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// delegations maps the ASCII names of the delegation points of a zone to the nameservers of their NS records. Every
+// NS record below the apex delegates its name, resolvers never ask the zone for names at or below it.
+type delegations map[string][]string
+
+// findDelegations returns the delegation points of the records of one zone
+func findDelegations(records []*anxcloudDns.Record) delegations {
+	found := make(delegations)
+	for _, record := range records {
+		if !strings.EqualFold(record.Type, endpoint.RecordTypeNS) || isApexRecordName(record.Name) {
+			continue
+		}
+		name := normalizeDomainName(domainName(record.Name, record.ZoneName))
+		found[name] = append(found[name], canonicalDomainName(record.RData))
+	}
+	for _, nameservers := range found {
+		sort.Strings(nameservers)
+	}
+	return found
+}
+
+// hides returns the delegation point which hides the record with the ASCII name and type from resolvers. The NS
+// records of the delegation point and glue records of nameservers below it are not hidden, as the delegation
+// consists of them.
+func (d delegations) hides(asciiName, recordType string) (string, bool) {
+	asciiName = normalizeDomainName(asciiName)
+	hiding := ""
+	for point, nameservers := range d {
+		if !isSubdomainOf(asciiName, point) {
+			continue
+		}
+		if asciiName == point && strings.EqualFold(recordType, endpoint.RecordTypeNS) {
+			continue
+		}
+		if isAddressType(recordType) && slices.Contains(nameservers, asciiName) {
+			continue
+		}
+		// of nested delegations the topmost one is reported
+		if hiding == "" || len(point) < len(hiding) {
+			hiding = point
+		}
+	}
+	return hiding, hiding != ""
+}
+
+// withoutDelegatedRecords drops all records of an endpoint if one of them would be created at or below a name the
+// NS records of the zone delegate to other nameservers, as resolvers ask those nameservers and would never see the
+// record. Records of the delegation itself, the NS records and the glue, are kept. If the endpoint replaces older
+// records, those are not deleted either.
+func (p *Provider) withoutDelegatedRecords(ctx context.Context, snapshot *zoneSnapshot, recordsToDelete, recordsToCreate []*anxcloudDns.Record,
+	recordSources map[*anxcloudDns.Record]*endpoint.Endpoint) ([]*anxcloudDns.Record, []*anxcloudDns.Record, error) {
+	zoneDelegations := make(map[string]delegations)
+	refused := make(map[*endpoint.Endpoint]bool)
+	for _, record := range recordsToCreate {
+		ep := recordSources[record]
+		if refused[ep] {
+			continue
+		}
+		if _, found := zoneDelegations[record.ZoneName]; !found {
+			current, err := snapshot.zoneRecords(ctx, record.ZoneName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get records of zone %s for the delegation check: %w", record.ZoneName, err)
+			}
+			zoneDelegations[record.ZoneName] = findDelegations(current)
+		}
+		delegated := zoneDelegations[record.ZoneName]
+		if point, hidden := delegated.hides(domainName(record.Name, record.ZoneName), record.Type); hidden {
+			log.Warnf("skipping creation of %s record %s, %s is delegated to %s by NS records in zone %s, resolvers would never see the record",
+				ep.RecordType, ep.DNSName, point, strings.Join(delegated[point], ", "), record.ZoneName)
+			delegatedEndpointsCounter.Inc()
+			refused[ep] = true
+		}
+	}
+	if len(refused) == 0 {
+		return recordsToDelete, recordsToCreate, nil
+	}
+	remaining := make([]*anxcloudDns.Record, 0, len(recordsToCreate))
+	refusedRecords := make([]*anxcloudDns.Record, 0)
+	for _, record := range recordsToCreate {
+		if refused[recordSources[record]] {
+			refusedRecords = append(refusedRecords, record)
+			continue
+		}
+		remaining = append(remaining, record)
+	}
+	return keepReplacedRecords(recordsToDelete, refusedRecords), remaining, nil
+}
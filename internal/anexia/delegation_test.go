@@ -0,0 +1,103 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+var testDelegationRecords = []*anxcloudDns.Record{
+	{Identifier: "apex-ns", ZoneName: "a.de", Name: "@", Type: "NS", TTL: 3600, RData: "ns1.anexia.com."},
+	{Identifier: "sub-ns1", ZoneName: "a.de", Name: "sub", Type: "NS", TTL: 3600, RData: "ns1.other.com."},
+	{Identifier: "sub-ns2", ZoneName: "a.de", Name: "sub", Type: "NS", TTL: 3600, RData: "ns.sub.a.de."},
+	{Identifier: "glue", ZoneName: "a.de", Name: "ns.sub", Type: "A", TTL: 3600, RData: "192.0.2.53"},
+	{Identifier: "hidden", ZoneName: "a.de", Name: "www.sub", Type: "A", TTL: 300, RData: "192.0.2.1"},
+	{Identifier: "www", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "192.0.2.2"},
+}
+
+func TestDelegationsHides(t *testing.T) {
+	delegated := findDelegations(testDelegationRecords)
+	require.Equal(t, delegations{"sub.a.de": {"ns.sub.a.de", "ns1.other.com"}}, delegated)
+
+	testCases := []struct {
+		name          string
+		givenName     string
+		givenType     string
+		expectedPoint string
+	}{
+		{name: "name outside of the delegation", givenName: "www.a.de", givenType: "A"},
+		{name: "name which only ends like the delegation", givenName: "mysub.a.de", givenType: "A"},
+		{name: "apex", givenName: "a.de", givenType: "TXT"},
+		{name: "NS records of the delegation point", givenName: "sub.a.de", givenType: "NS"},
+		{name: "glue record", givenName: "ns.sub.a.de", givenType: "AAAA"},
+		{name: "other records of the delegation point", givenName: "sub.a.de", givenType: "TXT", expectedPoint: "sub.a.de"},
+		{name: "name below the delegation", givenName: "www.sub.a.de.", givenType: "A", expectedPoint: "sub.a.de"},
+		{name: "non-address record of a nameserver", givenName: "ns.sub.a.de", givenType: "TXT", expectedPoint: "sub.a.de"},
+		{name: "NS records below the delegation", givenName: "deeper.sub.a.de", givenType: "NS", expectedPoint: "sub.a.de"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			point, hidden := delegated.hides(tc.givenName, tc.givenType)
+			assert.Equal(t, tc.expectedPoint, point)
+			assert.Equal(t, tc.expectedPoint != "", hidden)
+		})
+	}
+}
+
+func TestApplyChangesDelegation(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": testDelegationRecords},
+	}
+	provider := &Provider{client: mockDNSClient}
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("app.sub.a.de", "A", 300, "192.0.2.10"),
+			endpoint.NewEndpointWithTTL("sub.a.de", "TXT", 300, "hidden"),
+			endpoint.NewEndpointWithTTL("sub.a.de", "NS", 3600, "ns2.other.com"),
+			endpoint.NewEndpointWithTTL("app.a.de", "A", 300, "192.0.2.11"),
+		},
+	}))
+
+	created := make([]string, 0)
+	for _, record := range mockDNSClient.createdRecords["a.de"] {
+		created = append(created, record.Name+" "+record.Type)
+	}
+	assert.Equal(t, []string{"sub NS", "app A"}, created)
+}
+
+func TestApplyChangesDelegationKeepsUpdatedRecord(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": testDelegationRecords},
+	}
+	provider := &Provider{client: mockDNSClient}
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.sub.a.de", "A", 300, "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.sub.a.de", "A", 300, "192.0.2.10")},
+	}))
+
+	assert.Empty(t, mockDNSClient.createdRecords["a.de"])
+	assert.Empty(t, mockDNSClient.deletedRecords["a.de"], "the old record is kept when its replacement is refused")
+}
+
+func TestRecordsDelegation(t *testing.T) {
+	provider := &Provider{client: &mockDNSClient{allRecords: testDelegationRecords}}
+
+	endpoints, err := provider.Records(context.Background())
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName+" "+ep.RecordType)
+	}
+	assert.Equal(t, []string{"ns.sub.a.de A", "sub.a.de NS", "www.a.de A"}, names)
+}
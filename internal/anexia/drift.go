@@ -0,0 +1,232 @@
+package anexia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DriftKind describes how a record differs from the last applied state
+type DriftKind string
+
+const (
+	// DriftMissing is a record which was applied, but does not exist anymore
+	DriftMissing DriftKind = "missing"
+	// DriftChanged is a record whose targets or TTL were changed outside of external-dns
+	DriftChanged DriftKind = "changed"
+)
+
+// Drift is a single record which differs from the last applied state
+type Drift struct {
+	Kind    DriftKind          `json:"kind"`
+	Desired *endpoint.Endpoint `json:"desired"`
+	Actual  *endpoint.Endpoint `json:"actual,omitempty"`
+}
+
+// DriftReport is the result of a single drift check
+type DriftReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Repair    bool      `json:"repair"`
+	Drifts    []Drift   `json:"drifts"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// driftDetector keeps the last applied endpoints in the state store to compare them with the records at Anexia
+type driftDetector struct {
+	store    state.Store
+	interval time.Duration
+	repair   bool
+
+	mu     sync.Mutex
+	report *DriftReport
+}
+
+func newDriftDetector(store state.Store, interval time.Duration, repair bool) *driftDetector {
+	return &driftDetector{store: store, interval: interval, repair: repair}
+}
+
+// recordChanges updates the desired state with the deleted and the created endpoints of successfully applied
+// changes. Endpoints which were refused are not passed in, so they do not show up as missing.
+func (d *driftDetector) recordChanges(deleted, created []*endpoint.Endpoint) error {
+	for _, ep := range deleted {
+		if err := d.store.DeleteDesired(endpointKey(ep)); err != nil {
+			return err
+		}
+	}
+	for _, ep := range created {
+		if err := d.store.PutDesired(endpointKey(ep), ep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptedEndpoints returns the endpoints of the changes whose records were all accepted for creation, records which
+// exist already count as accepted. Endpoints without records, like those outside of the domain filter or of all
+// zones, and endpoints with a refused record, like a CNAME conflict or a delegated name, are left out. The origins
+// map the endpoints the records were built from to the endpoints of the changes.
+func acceptedEndpoints(built, accepted []*anxcloudDns.Record, recordSources map[*anxcloudDns.Record]*endpoint.Endpoint,
+	origins map[*endpoint.Endpoint]*endpoint.Endpoint) []*endpoint.Endpoint {
+	isAccepted := make(map[*anxcloudDns.Record]bool, len(accepted))
+	for _, record := range accepted {
+		isAccepted[record] = true
+	}
+	refused := make(map[*endpoint.Endpoint]bool)
+	endpoints := make([]*endpoint.Endpoint, 0)
+	seen := make(map[*endpoint.Endpoint]bool)
+	for _, record := range built {
+		origin := origins[recordSources[record]]
+		if origin == nil {
+			continue
+		}
+		if !isAccepted[record] {
+			refused[origin] = true
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			endpoints = append(endpoints, origin)
+		}
+	}
+	result := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if !refused[ep] {
+			result = append(result, ep)
+		}
+	}
+	return result
+}
+
+// findDrifts compares the desired with the actual endpoints. Records which exist at Anexia but were never
+// applied are not reported, as they might be managed by someone else.
+func findDrifts(desired, actual []*endpoint.Endpoint) []Drift {
+	actualByKey := make(map[string]*endpoint.Endpoint, len(actual))
+	for _, ep := range actual {
+		actualByKey[endpointKey(ep)] = ep
+	}
+
+	drifts := make([]Drift, 0)
+	for _, desiredEndpoint := range desired {
+		actualEndpoint, ok := actualByKey[endpointKey(desiredEndpoint)]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DriftMissing, Desired: desiredEndpoint})
+			continue
+		}
+		ttlChanged := desiredEndpoint.RecordTTL.IsConfigured() && desiredEndpoint.RecordTTL != actualEndpoint.RecordTTL
+		if ttlChanged || !targetsEqual(desiredEndpoint.RecordType, desiredEndpoint.Targets, actualEndpoint.Targets) {
+			drifts = append(drifts, Drift{Kind: DriftChanged, Desired: desiredEndpoint, Actual: actualEndpoint})
+		}
+	}
+	return drifts
+}
+
+// StartDriftDetection periodically compares the last applied endpoints with the records at Anexia until the
+// context is done. It does nothing if drift detection is not enabled.
+func (p *Provider) StartDriftDetection(ctx context.Context) {
+	if p.drift == nil {
+		return
+	}
+	log.Infof("starting drift detection every %s, repair: %t", p.drift.interval, p.drift.repair)
+
+	go func() {
+		ticker := time.NewTicker(p.drift.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Info("stopping drift detection")
+				return
+			case <-ticker.C:
+				if _, err := p.CheckDrift(ctx); err != nil {
+					log.Errorf("drift check failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// CheckDrift compares the last applied endpoints with the records at Anexia and repairs the drift if enabled
+func (p *Provider) CheckDrift(ctx context.Context) (*DriftReport, error) {
+	if p.drift == nil {
+		return nil, errors.New("drift detection is not enabled")
+	}
+
+	// changes applied by external-dns meanwhile would make the comparison stale and the repair create records twice
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := &DriftReport{CheckedAt: time.Now(), Repair: p.drift.repair, Drifts: make([]Drift, 0)}
+	defer func() {
+		p.drift.mu.Lock()
+		p.drift.report = report
+		p.drift.mu.Unlock()
+	}()
+
+	desired, err := p.drift.store.ListDesired()
+	if err != nil {
+		driftChecksCounter.WithLabelValues("error").Inc()
+		report.Error = fmt.Sprintf("failed to read the desired state: %v", err)
+		return report, fmt.Errorf("failed to read the desired state: %w", err)
+	}
+	actual, err := p.Records(ctx)
+	if err != nil {
+		driftChecksCounter.WithLabelValues("error").Inc()
+		report.Error = err.Error()
+		return report, err
+	}
+	driftChecksCounter.WithLabelValues("success").Inc()
+
+	report.Drifts = findDrifts(desired, actual)
+	counts := map[DriftKind]float64{DriftMissing: 0, DriftChanged: 0}
+	for _, drift := range report.Drifts {
+		counts[drift.Kind]++
+		log.Warnf("drift detected, %s record %s is %s, desired targets: %v, ttl: %d",
+			drift.Desired.RecordType, drift.Desired.DNSName, drift.Kind, drift.Desired.Targets, drift.Desired.RecordTTL)
+	}
+	for kind, count := range counts {
+		driftRecordsGauge.WithLabelValues(string(kind)).Set(count)
+	}
+	log.Debugf("drift check done, %d drifted records", len(report.Drifts))
+
+	if !p.drift.repair || len(report.Drifts) == 0 {
+		return report, nil
+	}
+
+	changes := &plan.Changes{}
+	for _, drift := range report.Drifts {
+		if drift.Kind == DriftMissing {
+			changes.Create = append(changes.Create, drift.Desired)
+		} else {
+			changes.UpdateOld = append(changes.UpdateOld, drift.Actual)
+			changes.UpdateNew = append(changes.UpdateNew, drift.Desired)
+		}
+	}
+	if err := p.applyChanges(ctx, changes); err != nil {
+		driftRepairsCounter.WithLabelValues("error").Inc()
+		report.Error = fmt.Sprintf("repair failed: %v", err)
+		return report, err
+	}
+	driftRepairsCounter.WithLabelValues("success").Inc()
+	log.Infof("repaired %d drifted records", len(report.Drifts))
+	return report, nil
+}
+
+// DriftReport returns the result of the last drift check, enabled is false if drift detection is not enabled
+func (p *Provider) DriftReport() (report any, enabled bool) {
+	if p.drift == nil {
+		return nil, false
+	}
+	p.drift.mu.Lock()
+	defer p.drift.mu.Unlock()
+	if p.drift.report == nil {
+		return nil, true
+	}
+	return p.drift.report, true
+}
@@ -0,0 +1,192 @@
+package anexia
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestDriftDetectorRecordChanges(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "state.db")
+	store, err := state.NewBoltStore(stateFile)
+	require.NoError(t, err)
+	detector := newDriftDetector(store, time.Minute, false)
+
+	err = detector.recordChanges(nil, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2"),
+	})
+	require.NoError(t, err)
+
+	err = detector.recordChanges([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2"),
+	}, []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 600, "4.4.4.4")})
+	require.NoError(t, err)
+
+	// the state survives a restart
+	require.NoError(t, store.Close())
+	reopened, err := state.NewBoltStore(stateFile)
+	require.NoError(t, err)
+	defer reopened.Close()
+	desired, err := newDriftDetector(reopened, time.Minute, false).store.ListDesired()
+	require.NoError(t, err)
+	require.Len(t, desired, 1)
+	assert.Equal(t, "a.de", desired[0].DNSName)
+	assert.Equal(t, endpoint.TTL(600), desired[0].RecordTTL)
+	assert.Equal(t, endpoint.Targets{"4.4.4.4"}, desired[0].Targets)
+}
+
+func TestApplyChangesRecordsOnlyAcceptedEndpoints(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"de": {
+				{Identifier: "1", Name: "www", ZoneName: "de", Type: "A", TTL: 300, RData: "9.9.9.9"},
+				{Identifier: "2", Name: "kept", ZoneName: "de", Type: "A", TTL: 300, RData: "3.3.3.3"},
+			},
+		},
+	}
+	provider := &Provider{
+		client:       mockDNSClient,
+		domainFilter: endpoint.NewDomainFilter([]string{"de", "com"}),
+		drift:        newDriftDetector(store, time.Minute, true),
+	}
+	require.NoError(t, provider.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("kept.de", "A", 300, "3.3.3.3"),
+			endpoint.NewEndpointWithTTL("www.de", "CNAME", 300, "other.com"),
+			endpoint.NewEndpointWithTTL("filtered.org", "A", 300, "2.2.2.2"),
+			endpoint.NewEndpointWithTTL("no-zone.com", "A", 300, "2.2.2.2"),
+		},
+	}))
+
+	desired, err := store.ListDesired()
+	require.NoError(t, err)
+	names := make([]string, 0, len(desired))
+	for _, ep := range desired {
+		names = append(names, ep.DNSName)
+	}
+	assert.Equal(t, []string{"a.de", "kept.de"}, names, "refused and filtered endpoints are not recorded")
+}
+
+func TestFindDrifts(t *testing.T) {
+	testCases := []struct {
+		name           string
+		desired        []*endpoint.Endpoint
+		actual         []*endpoint.Endpoint
+		expectedDrifts []Drift
+	}{
+		{
+			name:           "no drift",
+			desired:        []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1", "2.2.2.2")},
+			actual:         []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "2.2.2.2", "1.1.1.1")},
+			expectedDrifts: []Drift{},
+		},
+		{
+			name:           "unset desired ttl is ignored",
+			desired:        []*endpoint.Endpoint{endpoint.NewEndpoint("a.de", "A", "1.1.1.1")},
+			actual:         []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 3600, "1.1.1.1")},
+			expectedDrifts: []Drift{},
+		},
+		{
+			name:    "missing record",
+			desired: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1")},
+			actual:  []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "AAAA", 300, "::1")},
+			expectedDrifts: []Drift{
+				{Kind: DriftMissing, Desired: endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1")},
+			},
+		},
+		{
+			name:    "changed targets and ttl",
+			desired: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"), endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2")},
+			actual:  []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "9.9.9.9"), endpoint.NewEndpointWithTTL("b.de", "A", 60, "2.2.2.2")},
+			expectedDrifts: []Drift{
+				{Kind: DriftChanged, Desired: endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"), Actual: endpoint.NewEndpointWithTTL("a.de", "A", 300, "9.9.9.9")},
+				{Kind: DriftChanged, Desired: endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2"), Actual: endpoint.NewEndpointWithTTL("b.de", "A", 60, "2.2.2.2")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDrifts, findDrifts(tc.desired, tc.actual))
+		})
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	ctx := context.Background()
+	for _, repair := range []bool{false, true} {
+		detector := newDriftDetector(state.NewMemoryStore(), time.Minute, repair)
+		mockDNSClient := &mockDNSClient{
+			allZones: createZoneSlice(1, func(_ int) string { return "de" }),
+			allRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "a", ZoneName: "de", Type: "A", TTL: 300, RData: "9.9.9.9"},
+			},
+			zoneRecords: map[string][]*anxcloudDns.Record{
+				"de": {{Identifier: "1", Name: "a", ZoneName: "de", Type: "A", TTL: 300, RData: "9.9.9.9"}},
+			},
+		}
+		provider := &Provider{client: mockDNSClient, drift: detector}
+
+		_, enabled := provider.DriftReport()
+		assert.True(t, enabled)
+
+		require.NoError(t, detector.recordChanges(nil, []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2"),
+		}))
+
+		report, err := provider.CheckDrift(ctx)
+		require.NoError(t, err)
+		assert.Len(t, report.Drifts, 2)
+		assert.Equal(t, repair, report.Repair)
+
+		lastReport, _ := provider.DriftReport()
+		assert.Equal(t, report, lastReport)
+
+		if !repair {
+			assert.Empty(t, mockDNSClient.createdRecords)
+			assert.Empty(t, mockDNSClient.deletedRecords)
+			continue
+		}
+		assert.Equal(t, []string{"1"}, mockDNSClient.deletedRecords["de"])
+		assert.Len(t, mockDNSClient.createdRecords["de"], 2)
+	}
+}
+
+func TestNewProviderDriftDetectionRequiresStateStore(t *testing.T) {
+	t.Setenv("ANEXIA_API_TOKEN", "1")
+	t.Setenv("DRIFT_DETECTION_INTERVAL", "5m")
+	configuration := &Configuration{}
+	require.NoError(t, env.Parse(configuration))
+
+	_, err := NewProvider(configuration, endpoint.DomainFilter{})
+	assert.EqualError(t, err, "drift detection keeps the last applied endpoints in the state store, STATE_STORE must be set")
+
+	configuration.StateStore = state.TypeMemory
+	provider, err := NewProvider(configuration, endpoint.DomainFilter{})
+	require.NoError(t, err)
+	assert.Same(t, provider.state, provider.drift.store)
+}
+
+func TestDriftDetectionDisabled(t *testing.T) {
+	provider := &Provider{}
+	_, enabled := provider.DriftReport()
+	assert.False(t, enabled)
+	_, err := provider.CheckDrift(context.Background())
+	assert.EqualError(t, err, "drift detection is not enabled")
+}
@@ -1,28 +1,180 @@
 package anexia
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 )
 
+// GetCreateDeleteSetsFromChanges returns the endpoints to create and to delete. An update deletes the old and creates
+// the new endpoint, unless they do not differ. The old and new endpoints of updates are paired by name, record type and
+// set identifier, not by their position, an update without counterpart is applied as delete or create. Missing
+// endpoints are skipped, so a malformed plan can not crash the provider.
 func GetCreateDeleteSetsFromChanges(changes *plan.Changes) ([]*endpoint.Endpoint, []*endpoint.Endpoint) {
-	toCreate := make([]*endpoint.Endpoint, len(changes.Create))
-	copy(toCreate, changes.Create)
-
-	toDelete := make([]*endpoint.Endpoint, len(changes.Delete))
-	copy(toDelete, changes.Delete)
+	if changes == nil {
+		return []*endpoint.Endpoint{}, []*endpoint.Endpoint{}
+	}
+	toCreate := withoutMissingEndpoints(changes.Create, "create")
+	toDelete := withoutMissingEndpoints(changes.Delete, "delete")
 
-	for i, updateOldEndpoint := range changes.UpdateOld {
-		updateNewEndpoint := changes.UpdateNew[i]
+	updateNew := withoutMissingEndpoints(changes.UpdateNew, "updateNew")
+	// the new endpoints by key in the order of the plan, a key might occur more than once
+	candidates := make(map[string][]*endpoint.Endpoint, len(updateNew))
+	for _, ep := range updateNew {
+		key := endpointKey(ep)
+		candidates[key] = append(candidates[key], ep)
+	}
+	paired := make(map[*endpoint.Endpoint]bool, len(updateNew))
+	for _, updateOldEndpoint := range withoutMissingEndpoints(changes.UpdateOld, "updateOld") {
+		key := endpointKey(updateOldEndpoint)
+		if len(candidates[key]) == 0 {
+			log.Warnf("the update of the %s record %s has no new endpoint, deleting it", updateOldEndpoint.RecordType, updateOldEndpoint.DNSName)
+			toDelete = append(toDelete, updateOldEndpoint)
+			continue
+		}
+		updateNewEndpoint := candidates[key][0]
+		candidates[key] = candidates[key][1:]
+		paired[updateNewEndpoint] = true
 		if endpointsAreDifferent(*updateOldEndpoint, *updateNewEndpoint) {
 			toDelete = append(toDelete, updateOldEndpoint)
 			toCreate = append(toCreate, updateNewEndpoint)
 		}
 	}
+	for _, updateNewEndpoint := range updateNew {
+		if !paired[updateNewEndpoint] {
+			log.Warnf("the update of the %s record %s has no old endpoint, creating it", updateNewEndpoint.RecordType, updateNewEndpoint.DNSName)
+			toCreate = append(toCreate, updateNewEndpoint)
+		}
+	}
 	return toCreate, toDelete
 }
 
+// withoutMissingEndpoints returns a copy of the endpoints without nil entries
+func withoutMissingEndpoints(endpoints []*endpoint.Endpoint, kind string) []*endpoint.Endpoint {
+	result := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for i, ep := range endpoints {
+		if ep == nil {
+			log.Warnf("skipping the missing endpoint %d of %s in the changes", i, kind)
+			continue
+		}
+		result = append(result, ep)
+	}
+	return result
+}
+
+// providerSpecificMixedTTLs marks a current endpoint whose records have different TTLs, it holds the sorted TTLs.
+// Desired endpoints never carry it, so external-dns plans an update even if the desired endpoint has no TTL.
+const providerSpecificMixedTTLs = "webhook/anexia-mixed-ttls"
+
+// comparedProperties are the provider-specific properties whose change requires the records to be rewritten
+var comparedProperties = []string{providerSpecificFlattenedAddresses, providerSpecificWithheldTargets, providerSpecificMixedTTLs}
+
 func endpointsAreDifferent(a endpoint.Endpoint, b endpoint.Endpoint) bool {
-	return a.DNSName != b.DNSName || a.RecordType != b.RecordType ||
-		a.RecordTTL != b.RecordTTL || !a.Targets.Same(b.Targets)
+	if a.DNSName != b.DNSName || a.RecordType != b.RecordType ||
+		a.RecordTTL != b.RecordTTL || !targetsEqual(a.RecordType, a.Targets, b.Targets) {
+		return true
+	}
+	for _, name := range comparedProperties {
+		valueA, _ := a.GetProviderSpecificProperty(name)
+		valueB, _ := b.GetProviderSpecificProperty(name)
+		if valueA != valueB {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointKey identifies an endpoint by its name, record type and set identifier
+func endpointKey(ep *endpoint.Endpoint) string {
+	return strings.ToLower(strings.TrimSuffix(ep.DNSName, ".")) + "|" + ep.RecordType + "|" + ep.SetIdentifier
+}
+
+// mergeEndpoints merges the endpoints of single records into one endpoint per name, record type and set identifier.
+// The result is sorted by name and record type and the targets are sorted. If the records of one endpoint have
+// different TTLs, the endpoint is returned without TTL and marked with the mixed TTLs, so external-dns plans an update
+// which rewrites all records with the desired TTL.
+func mergeEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	groups := make(map[string][]*endpoint.Endpoint)
+	keys := make([]string, 0)
+	for _, ep := range endpoints {
+		key := endpointKey(ep)
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], ep)
+	}
+
+	merged := make([]*endpoint.Endpoint, 0, len(groups))
+	for _, key := range keys {
+		group := groups[key]
+		// keep the endpoints of the single records in the order of their targets, so their metadata can be merged
+		sort.SliceStable(group, func(i, j int) bool {
+			return firstTarget(group[i]) < firstTarget(group[j])
+		})
+		mergedEndpoint := &endpoint.Endpoint{
+			DNSName:       group[0].DNSName,
+			RecordType:    group[0].RecordType,
+			SetIdentifier: group[0].SetIdentifier,
+			RecordTTL:     group[0].RecordTTL,
+			Targets:       endpoint.Targets{},
+		}
+		if len(group[0].ProviderSpecific) > 0 {
+			mergedEndpoint.ProviderSpecific = append(endpoint.ProviderSpecific{}, group[0].ProviderSpecific...)
+		}
+		ttls := make(map[endpoint.TTL]bool)
+		for _, ep := range group {
+			mergedEndpoint.Targets = append(mergedEndpoint.Targets, ep.Targets...)
+			ttls[ep.RecordTTL] = true
+		}
+		sort.Strings(mergedEndpoint.Targets)
+		mergeRecordMetadata(mergedEndpoint, group)
+		if len(ttls) > 1 {
+			log.Warnf("drift detected, the %s records of %s have mixed TTLs %s, the next sync rewrites them with the desired TTL",
+				mergedEndpoint.RecordType, mergedEndpoint.DNSName, formatTTLs(ttls))
+			mergedEndpoint.RecordTTL = 0
+			mergedEndpoint.SetProviderSpecificProperty(providerSpecificMixedTTLs, formatTTLs(ttls))
+		}
+		merged = append(merged, mergedEndpoint)
+	}
+
+	sortEndpoints(merged)
+	return merged
+}
+
+// sortEndpoints sorts endpoints by name, record type and set identifier
+func sortEndpoints(endpoints []*endpoint.Endpoint) {
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].DNSName != endpoints[j].DNSName {
+			return endpoints[i].DNSName < endpoints[j].DNSName
+		}
+		if endpoints[i].RecordType != endpoints[j].RecordType {
+			return endpoints[i].RecordType < endpoints[j].RecordType
+		}
+		return endpoints[i].SetIdentifier < endpoints[j].SetIdentifier
+	})
+}
+
+func firstTarget(ep *endpoint.Endpoint) string {
+	if len(ep.Targets) == 0 {
+		return ""
+	}
+	return ep.Targets[0]
+}
+
+func formatTTLs(ttls map[endpoint.TTL]bool) string {
+	values := make([]int, 0, len(ttls))
+	for ttl := range ttls {
+		values = append(values, int(ttl))
+	}
+	sort.Ints(values)
+	formatted := make([]string, 0, len(values))
+	for _, value := range values {
+		formatted = append(formatted, strconv.Itoa(value))
+	}
+	return strings.Join(formatted, ",")
 }
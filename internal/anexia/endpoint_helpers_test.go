@@ -0,0 +1,189 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestMergeEndpoints(t *testing.T) {
+	testCases := []struct {
+		name              string
+		givenEndpoints    []*endpoint.Endpoint
+		expectedEndpoints []*endpoint.Endpoint
+	}{
+		{
+			name:              "no endpoints",
+			givenEndpoints:    []*endpoint.Endpoint{},
+			expectedEndpoints: []*endpoint.Endpoint{},
+		},
+		{
+			name: "sorted by name and record type",
+			givenEndpoints: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("b.a.de", "TXT", 300, "text"),
+				endpoint.NewEndpointWithTTL("b.a.de", "A", 300, "1.1.1.1"),
+				endpoint.NewEndpointWithTTL("a.a.de", "A", 300, "2.2.2.2"),
+			},
+			expectedEndpoints: []*endpoint.Endpoint{
+				{DNSName: "a.a.de", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"2.2.2.2"}},
+				{DNSName: "b.a.de", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"1.1.1.1"}},
+				{DNSName: "b.a.de", RecordType: "TXT", RecordTTL: 300, Targets: endpoint.Targets{"text"}},
+			},
+		},
+		{
+			name: "targets merged and sorted",
+			givenEndpoints: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("a.de", "A", 300, "3.3.3.3"),
+				endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+				endpoint.NewEndpointWithTTL("a.de", "A", 300, "2.2.2.2"),
+			},
+			expectedEndpoints: []*endpoint.Endpoint{
+				{DNSName: "a.de", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+			},
+		},
+		{
+			name: "mixed TTLs are reported without TTL",
+			givenEndpoints: []*endpoint.Endpoint{
+				endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+				endpoint.NewEndpointWithTTL("a.de", "A", 600, "2.2.2.2"),
+				endpoint.NewEndpointWithTTL("b.de", "A", 600, "3.3.3.3"),
+			},
+			expectedEndpoints: []*endpoint.Endpoint{
+				{DNSName: "a.de", RecordType: "A", RecordTTL: 0, Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"},
+					ProviderSpecific: endpoint.ProviderSpecific{{Name: providerSpecificMixedTTLs, Value: "300,600"}}},
+				{DNSName: "b.de", RecordType: "A", RecordTTL: 600, Targets: endpoint.Targets{"3.3.3.3"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedEndpoints, mergeEndpoints(tc.givenEndpoints))
+		})
+	}
+}
+
+func TestMergeEndpointsIsDeterministic(t *testing.T) {
+	given := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("c.de", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("a.de", "A", 300, "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("b.de", "A", 300, "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+	}
+	expected := mergeEndpoints(given)
+	reversed := make([]*endpoint.Endpoint, len(given))
+	for i, ep := range given {
+		reversed[len(given)-1-i] = ep
+	}
+	assert.Equal(t, expected, mergeEndpoints(reversed))
+}
+
+func TestGetCreateDeleteSetsFromChanges(t *testing.T) {
+	oldA := endpoint.NewEndpointWithTTL("a.de", "A", 300, "192.0.2.1")
+	newA := endpoint.NewEndpointWithTTL("a.de", "A", 600, "192.0.2.1")
+	oldTXT := endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "old")
+	newTXT := endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "new")
+	oldEU := endpoint.NewEndpointWithTTL("a.de", "A", 300, "192.0.2.2").WithSetIdentifier("eu")
+	newEU := endpoint.NewEndpointWithTTL("a.de", "A", 300, "192.0.2.3").WithSetIdentifier("eu")
+	unchanged := endpoint.NewEndpointWithTTL("b.de", "A", 300, "192.0.2.4")
+	created := endpoint.NewEndpointWithTTL("c.de", "A", 300, "192.0.2.5")
+	deleted := endpoint.NewEndpointWithTTL("d.de", "A", 300, "192.0.2.6")
+
+	testCases := []struct {
+		name             string
+		givenChanges     *plan.Changes
+		expectedToCreate []*endpoint.Endpoint
+		expectedToDelete []*endpoint.Endpoint
+	}{
+		{
+			name:             "no changes",
+			givenChanges:     nil,
+			expectedToCreate: []*endpoint.Endpoint{},
+			expectedToDelete: []*endpoint.Endpoint{},
+		},
+		{
+			name: "updates in the same order",
+			givenChanges: &plan.Changes{
+				Create:    []*endpoint.Endpoint{created},
+				UpdateOld: []*endpoint.Endpoint{oldA, oldTXT},
+				UpdateNew: []*endpoint.Endpoint{newA, newTXT},
+				Delete:    []*endpoint.Endpoint{deleted},
+			},
+			expectedToCreate: []*endpoint.Endpoint{created, newA, newTXT},
+			expectedToDelete: []*endpoint.Endpoint{deleted, oldA, oldTXT},
+		},
+		{
+			name: "updates in different order are paired by name, type and set identifier",
+			givenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{oldA, oldTXT, oldEU},
+				UpdateNew: []*endpoint.Endpoint{newEU, newTXT, newA},
+			},
+			expectedToCreate: []*endpoint.Endpoint{newA, newTXT, newEU},
+			expectedToDelete: []*endpoint.Endpoint{oldA, oldTXT, oldEU},
+		},
+		{
+			name: "updates which do not differ are skipped",
+			givenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{unchanged, oldA},
+				UpdateNew: []*endpoint.Endpoint{newA, unchanged},
+			},
+			expectedToCreate: []*endpoint.Endpoint{newA},
+			expectedToDelete: []*endpoint.Endpoint{oldA},
+		},
+		{
+			name: "old endpoint without new endpoint is deleted",
+			givenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{oldA, oldTXT},
+				UpdateNew: []*endpoint.Endpoint{newTXT},
+			},
+			expectedToCreate: []*endpoint.Endpoint{newTXT},
+			expectedToDelete: []*endpoint.Endpoint{oldA, oldTXT},
+		},
+		{
+			name: "new endpoint without old endpoint is created",
+			givenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{oldTXT},
+				UpdateNew: []*endpoint.Endpoint{newA, newTXT},
+			},
+			expectedToCreate: []*endpoint.Endpoint{newTXT, newA},
+			expectedToDelete: []*endpoint.Endpoint{oldTXT},
+		},
+		{
+			name: "missing endpoints are skipped",
+			givenChanges: &plan.Changes{
+				Create:    []*endpoint.Endpoint{nil, created},
+				UpdateOld: []*endpoint.Endpoint{oldA, nil},
+				UpdateNew: []*endpoint.Endpoint{nil, newA},
+				Delete:    []*endpoint.Endpoint{nil},
+			},
+			expectedToCreate: []*endpoint.Endpoint{created, newA},
+			expectedToDelete: []*endpoint.Endpoint{oldA},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			toCreate, toDelete := GetCreateDeleteSetsFromChanges(tc.givenChanges)
+			assert.Equal(t, tc.expectedToCreate, toCreate)
+			assert.Equal(t, tc.expectedToDelete, toDelete)
+		})
+	}
+}
+
+func TestApplyChangesWithMalformedChanges(t *testing.T) {
+	mockDNSClient := &mockDNSClient{allZones: createZoneSlice(1, func(_ int) string { return "a.de" })}
+	provider := &Provider{client: mockDNSClient}
+
+	assert.NotPanics(t, func() {
+		assert.NoError(t, provider.ApplyChanges(context.Background(), nil))
+		assert.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+			Create:    []*endpoint.Endpoint{nil, endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "192.0.2.1")},
+			UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.a.de", "A", 300, "192.0.2.2"), nil},
+			UpdateNew: []*endpoint.Endpoint{nil},
+		}))
+	})
+	assert.Len(t, mockDNSClient.createdRecords["a.de"], 1)
+}
@@ -0,0 +1,87 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// withoutExistingRecords checks the records to create against the current contents of their zones, so repeating a
+// partially applied change or creating a record which was added by hand does not create duplicates. Records which
+// exist with the same name, type, region and rdata are not created again, if only their TTL differs, the existing
+// record is returned for a TTL update. Records which are deleted by the same changes do not count as existing. The
+// records to update are added to the record sources with the endpoint of the record they replace.
+func (p *Provider) withoutExistingRecords(ctx context.Context, snapshot *zoneSnapshot, recordsToDelete, recordsToCreate []*anxcloudDns.Record,
+	recordSources map[*anxcloudDns.Record]*endpoint.Endpoint) ([]*anxcloudDns.Record, []*anxcloudDns.Record, error) {
+	deleted := make(map[string]bool, len(recordsToDelete))
+	for _, record := range recordsToDelete {
+		deleted[record.ZoneName+"|"+record.Identifier] = true
+	}
+
+	zoneRecords := make(map[string][]*anxcloudDns.Record)
+	used := make(map[*anxcloudDns.Record]bool)
+	creates := make([]*anxcloudDns.Record, 0, len(recordsToCreate))
+	updates := make([]*anxcloudDns.Record, 0)
+	skipped := 0
+	for _, record := range recordsToCreate {
+		if _, found := zoneRecords[record.ZoneName]; !found {
+			current, err := snapshot.zoneRecords(ctx, record.ZoneName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get records of zone %s for the duplicate check: %w", record.ZoneName, err)
+			}
+			remaining := make([]*anxcloudDns.Record, 0, len(current))
+			for _, currentRecord := range current {
+				if !deleted[record.ZoneName+"|"+currentRecord.Identifier] {
+					remaining = append(remaining, currentRecord)
+				}
+			}
+			zoneRecords[record.ZoneName] = remaining
+		}
+
+		existing := findSameRecord(record, zoneRecords[record.ZoneName], used)
+		if existing == nil {
+			creates = append(creates, record)
+			// equal records of one change are only created once
+			zoneRecords[record.ZoneName] = append(zoneRecords[record.ZoneName], record)
+			continue
+		}
+		used[existing] = true
+		if existing.Identifier == "" || existing.TTL == record.TTL {
+			log.Infof("skipping creation of %s record %s in zone %s, it exists already", record.Type, record.Name, record.ZoneName)
+			existingRecordsCounter.WithLabelValues("skip").Inc()
+			skipped++
+			continue
+		}
+		log.Infof("updating the TTL of the existing %s record %s in zone %s from %d to %d", record.Type, record.Name, record.ZoneName, existing.TTL, record.TTL)
+		existingRecordsCounter.WithLabelValues("update_ttl").Inc()
+		updated := *existing
+		updated.TTL = record.TTL
+		updates = append(updates, &updated)
+		recordSources[&updated] = recordSources[record]
+	}
+	if skipped > 0 {
+		log.Infof("skipped %d records which exist already", skipped)
+	}
+	return creates, updates, nil
+}
+
+// findSameRecord returns the record with the same name, type, region and rdata. Existing records are only returned
+// once, planned records, which have no identifier yet, any number of times.
+func findSameRecord(record *anxcloudDns.Record, records []*anxcloudDns.Record, used map[*anxcloudDns.Record]bool) *anxcloudDns.Record {
+	name := domainName(record.Name, record.ZoneName)
+	for _, candidate := range records {
+		if used[candidate] && candidate.Identifier != "" {
+			continue
+		}
+		if strings.EqualFold(domainName(candidate.Name, record.ZoneName), name) &&
+			strings.EqualFold(candidate.Type, record.Type) && regionsEqual(candidate.Region, record.Region) &&
+			rdataEqual(record.Type, candidate.RData, record.RData) {
+			return candidate
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChangesSkipsExistingRecords(t *testing.T) {
+	testCases := []struct {
+		name            string
+		givenRecords    []*anxcloudDns.Record
+		whenChanges     *plan.Changes
+		expectedCreated []string // name, rdata and TTL
+		expectedUpdated []string // identifier and TTL
+		expectedDeleted []string
+	}{
+		{
+			name:         "exact duplicate in another format",
+			givenRecords: []*anxcloudDns.Record{{Identifier: "1", Name: "www", Type: "AAAA", RData: "2001:DB8:0::1", TTL: 300}},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "AAAA", 300, "2001:db8::1")},
+			},
+		},
+		{
+			name:         "TXT duplicate",
+			givenRecords: []*anxcloudDns.Record{{Identifier: "1", Name: "@", Type: "TXT", RData: "\"v=spf1 -all\"", TTL: 300}},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "v=spf1 -all")},
+			},
+		},
+		{
+			name:         "only the TTL differs",
+			givenRecords: []*anxcloudDns.Record{{Identifier: "1", Name: "www", Type: "A", RData: "192.0.2.1", TTL: 300}},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("WWW.a.de", "A", 600, "192.0.2.1")},
+			},
+			expectedUpdated: []string{"1 600"},
+		},
+		{
+			name: "partially applied endpoint",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", Name: "www", Type: "A", RData: "192.0.2.1", TTL: 300},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "192.0.2.1", "192.0.2.2")},
+			},
+			expectedCreated: []string{"www 192.0.2.2 300"},
+		},
+		{
+			name:         "record which is deleted by the same changes",
+			givenRecords: []*anxcloudDns.Record{{Identifier: "1", Name: "www", Type: "A", RData: "192.0.2.1", TTL: 300}},
+			whenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "192.0.2.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 600, "192.0.2.1")},
+			},
+			expectedCreated: []string{"www 192.0.2.1 600"},
+			expectedDeleted: []string{"1"},
+		},
+		{
+			name:         "record of another region",
+			givenRecords: []*anxcloudDns.Record{{Identifier: "1", Name: "www", Type: "A", RData: "192.0.2.1", TTL: 300, Region: "eu"}},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "192.0.2.1")},
+			},
+			expectedCreated: []string{"www 192.0.2.1 300"},
+		},
+		{
+			name: "equal records of one change",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "192.0.2.1"),
+					endpoint.NewEndpointWithTTL("www.a.de.", "A", 300, "192.0.2.1"),
+				},
+			},
+			expectedCreated: []string{"www 192.0.2.1 300"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, record := range tc.givenRecords {
+				record.ZoneName = "a.de"
+			}
+			mockDNSClient := &mockDNSClient{
+				allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+				zoneRecords: map[string][]*anxcloudDns.Record{"a.de": tc.givenRecords},
+			}
+			provider := &Provider{client: mockDNSClient}
+			require.NoError(t, provider.ApplyChanges(context.Background(), tc.whenChanges))
+
+			var created, updated []string
+			for _, record := range mockDNSClient.createdRecords["a.de"] {
+				created = append(created, fmt.Sprintf("%s %s %d", record.Name, record.RData, record.TTL))
+			}
+			for _, record := range mockDNSClient.updatedRecords["a.de"] {
+				updated = append(updated, fmt.Sprintf("%s %d", record.Identifier, record.TTL))
+			}
+			assert.Equal(t, tc.expectedCreated, created)
+			assert.Equal(t, tc.expectedUpdated, updated)
+			assert.Equal(t, tc.expectedDeleted, mockDNSClient.deletedRecords["a.de"])
+		})
+	}
+}
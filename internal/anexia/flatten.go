@@ -0,0 +1,388 @@
+package anexia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// providerSpecificFlattenedAddresses holds the comma separated addresses an apex CNAME is flattened to. Records
+// reports the published addresses, AdjustEndpoints the resolved ones, so changed addresses show up as update.
+const providerSpecificFlattenedAddresses = "webhook/anexia-flattened-addresses"
+
+const flatteningQueryTimeout = 5 * time.Second
+
+// flattener publishes CNAME endpoints at the apex of a zone as the A and AAAA records of their target, as a
+// CNAME is not allowed at the apex
+type flattener struct {
+	resolver string
+	interval time.Duration
+	client   *dns.Client
+
+	// store keeps the flattened apexes, so they are reported as CNAME after a restart as well, it might be nil
+	store state.Store
+
+	mu sync.Mutex
+	// flattened maps the ASCII name of each flattened apex to the CNAME target
+	flattened map[string]string
+	// resolved caches the addresses of the targets for the interval
+	resolved map[string]resolution
+}
+
+type resolution struct {
+	addresses []string
+	expires   time.Time
+}
+
+// newFlattener creates a flattener which resolves the targets with the resolver, a host with optional port. Without
+// resolver the first nameserver of /etc/resolv.conf is used. With an interval of zero the targets are resolved on
+// every sync, otherwise the addresses are reused for the interval. The flattened apexes are loaded from and kept in the
+// state store, if one is given.
+func newFlattener(resolver string, interval time.Duration, store state.Store) (*flattener, error) {
+	if resolver == "" {
+		config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the resolver for CNAME flattening: %w", err)
+		}
+		if len(config.Servers) == 0 {
+			return nil, errors.New("no resolver for CNAME flattening configured and none found in /etc/resolv.conf")
+		}
+		resolver = net.JoinHostPort(config.Servers[0], config.Port)
+	}
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+	flattened := make(map[string]string)
+	if store != nil {
+		var err error
+		if flattened, err = store.ListFlattened(); err != nil {
+			return nil, fmt.Errorf("failed to read the flattened apexes from the state: %w", err)
+		}
+	}
+	return &flattener{
+		resolver:  resolver,
+		interval:  interval,
+		client:    &dns.Client{Timeout: flatteningQueryTimeout},
+		store:     store,
+		flattened: flattened,
+		resolved:  make(map[string]resolution),
+	}, nil
+}
+
+// resolve returns the sorted A and AAAA addresses of the target, following CNAME chains
+func (f *flattener) resolve(ctx context.Context, target string) ([]string, error) {
+	target = canonicalDomainName(target)
+	f.mu.Lock()
+	cached, found := f.resolved[target]
+	f.mu.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.addresses, nil
+	}
+
+	addresses := make([]string, 0)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(target), qtype)
+		response, _, err := f.client.ExchangeContext(ctx, msg, f.resolver)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", target, err)
+		}
+		if response.Rcode != dns.RcodeSuccess {
+			return nil, fmt.Errorf("failed to resolve %s: %s", target, dns.RcodeToString[response.Rcode])
+		}
+		for _, rr := range response.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addresses = append(addresses, rr.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, rr.AAAA.String())
+			}
+		}
+	}
+	sort.Strings(addresses)
+
+	if f.interval > 0 {
+		f.mu.Lock()
+		f.resolved[target] = resolution{addresses: addresses, expires: time.Now().Add(f.interval)}
+		f.mu.Unlock()
+	}
+	return addresses, nil
+}
+
+// target returns the CNAME target of a flattened apex
+func (f *flattener) target(dnsName string) (string, bool) {
+	asciiName, err := toASCIIName(dnsName)
+	if err != nil {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, found := f.flattened[asciiName]
+	return target, found
+}
+
+// remember adds a flattened apex, failing to keep it in the state store is only logged
+func (f *flattener) remember(asciiName, target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flattened[asciiName] = target
+	if f.store != nil {
+		if err := f.store.PutFlattened(asciiName, target); err != nil {
+			log.Errorf("failed to add the flattened apex %s to the state: %v", asciiName, err)
+		}
+	}
+}
+
+func (f *flattener) forget(asciiName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.flattened, asciiName)
+	if f.store != nil {
+		if err := f.store.DeleteFlattened(asciiName); err != nil {
+			log.Errorf("failed to remove the flattened apex %s from the state: %v", asciiName, err)
+		}
+	}
+}
+
+// report replaces the A and AAAA endpoints of flattened apexes with the CNAME endpoint they were flattened from
+func (f *flattener) report(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	reported := make([]*endpoint.Endpoint, 0, len(endpoints))
+	cnames := make(map[string]*endpoint.Endpoint)
+	for _, ep := range endpoints {
+		target, found := f.target(ep.DNSName)
+		if !found || !isAddressType(ep.RecordType) || ep.SetIdentifier != "" {
+			reported = append(reported, ep)
+			continue
+		}
+		cname, found := cnames[ep.DNSName]
+		if !found {
+			cname = &endpoint.Endpoint{
+				DNSName:    ep.DNSName,
+				RecordType: endpoint.RecordTypeCNAME,
+				RecordTTL:  ep.RecordTTL,
+				Targets:    endpoint.Targets{canonicalTarget(endpoint.RecordTypeCNAME, target)},
+			}
+			cnames[ep.DNSName] = cname
+			reported = append(reported, cname)
+		}
+		addresses := append(flattenedAddresses(cname), ep.Targets...)
+		sort.Strings(addresses)
+		cname.SetProviderSpecificProperty(providerSpecificFlattenedAddresses, strings.Join(addresses, ","))
+	}
+	return reported
+}
+
+// adjust sets the resolved addresses of a desired apex CNAME endpoint which is flattened already, the published
+// name is the name of the endpoint at Anexia. If the target can not be resolved, the addresses of the current
+// endpoint are kept.
+func (f *flattener) adjust(ep *endpoint.Endpoint, publishedName string, current *endpoint.Endpoint) {
+	if ep.RecordType != endpoint.RecordTypeCNAME || len(ep.Targets) != 1 {
+		return
+	}
+	if _, found := f.target(publishedName); !found {
+		return
+	}
+	addresses, err := f.resolve(context.Background(), ep.Targets[0])
+	if err != nil || len(addresses) == 0 {
+		log.Warnf("keeping the addresses of the flattened CNAME %s, resolving %s failed: %v", ep.DNSName, ep.Targets[0], err)
+		if current != nil {
+			if value, found := current.GetProviderSpecificProperty(providerSpecificFlattenedAddresses); found {
+				ep.SetProviderSpecificProperty(providerSpecificFlattenedAddresses, value)
+			}
+		}
+		return
+	}
+	ep.SetProviderSpecificProperty(providerSpecificFlattenedAddresses, strings.Join(addresses, ","))
+}
+
+// flattenApexCNAMEs replaces the CNAME endpoints at the apex of a zone with A and AAAA endpoints. Endpoints to
+// delete are replaced with their published addresses, endpoints to create with the resolved addresses of their
+// target, the duplicate check skips the addresses which exist already. Addresses which are not resolved anymore are
+// only deleted if the webhook created them according to the state store, addresses added by hand and addresses the
+// A and AAAA endpoints to delete remove anyway are left alone. Endpoints whose target can not be resolved are
+// skipped, so the published addresses stay as they are. The address endpoints are added to the origins with the
+// origin of their CNAME endpoint.
+func (p *Provider) flattenApexCNAMEs(ctx context.Context, zones *zoneTrie, epToCreate, epToDelete []*endpoint.Endpoint,
+	origins map[*endpoint.Endpoint]*endpoint.Endpoint) ([]*endpoint.Endpoint, []*endpoint.Endpoint, error) {
+	if p.flattening == nil {
+		return epToCreate, epToDelete, nil
+	}
+
+	toDelete := make([]*endpoint.Endpoint, 0, len(epToDelete))
+	deletedAddresses := make(map[string]map[string]bool)
+	markDeleted := func(asciiName, recordType string, addresses []string) {
+		if deletedAddresses[asciiName] == nil {
+			deletedAddresses[asciiName] = make(map[string]bool, len(addresses))
+		}
+		for _, address := range addresses {
+			deletedAddresses[asciiName][canonicalRData(recordType, address)] = true
+		}
+	}
+	for _, ep := range epToDelete {
+		if isAddressType(ep.RecordType) {
+			// addresses at the apex deleted by the same changes do not count as existing
+			if asciiName, zone := p.apexZone(zones, ep); zone != nil {
+				if region, err := endpointRegion(ep); err == nil && region == "" {
+					markDeleted(asciiName, ep.RecordType, ep.Targets)
+				}
+			}
+		}
+		asciiName, zone := p.flattenableApex(zones, ep)
+		if zone == nil {
+			toDelete = append(toDelete, ep)
+			continue
+		}
+		p.flattening.forget(asciiName)
+		addresses := flattenedAddresses(ep)
+		for _, addressEp := range addressEndpoints(ep, addresses) {
+			markDeleted(asciiName, addressEp.RecordType, addressEp.Targets)
+			toDelete = append(toDelete, addressEp)
+		}
+	}
+
+	toCreate := make([]*endpoint.Endpoint, 0, len(epToCreate))
+	for _, ep := range epToCreate {
+		asciiName, zone := p.flattenableApex(zones, ep)
+		if zone == nil {
+			toCreate = append(toCreate, ep)
+			continue
+		}
+		addresses, err := p.flattening.resolve(ctx, ep.Targets[0])
+		if err == nil && len(addresses) == 0 {
+			err = errors.New("no A or AAAA records found")
+		}
+		if err != nil {
+			log.Errorf("skipping flattening of the CNAME %s to %s: %v", ep.DNSName, ep.Targets[0], err)
+			continue
+		}
+		log.Infof("flattening the CNAME %s to %s: %s", ep.DNSName, ep.Targets[0], strings.Join(addresses, ", "))
+		flatteningCounter.Inc()
+		p.flattening.remember(asciiName, ep.Targets[0])
+
+		existing, err := p.apexAddresses(ctx, zone, deletedAddresses[asciiName])
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved := make(map[string]bool, len(addresses))
+		for _, address := range addresses {
+			resolved[address] = true
+		}
+		stale := make([]string, 0)
+		for address, record := range existing {
+			if !resolved[address] && p.createdByWebhook(record) {
+				stale = append(stale, address)
+			}
+		}
+		sort.Strings(stale)
+		for _, addressEp := range addressEndpoints(ep, addresses) {
+			origins[addressEp] = origins[ep]
+			toCreate = append(toCreate, addressEp)
+		}
+		toDelete = append(toDelete, addressEndpoints(ep, stale)...)
+	}
+	return toCreate, toDelete, nil
+}
+
+// apexAddresses returns the records of the addresses at the apex of the zone which are not deleted
+func (p *Provider) apexAddresses(ctx context.Context, zone *anxcloudDns.Zone, deleted map[string]bool) (map[string]*anxcloudDns.Record, error) {
+	records, err := p.client.GetRecordsByZoneNameAndName(ctx, zone.Name, apexRecordName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the records at the apex of zone %s: %w", zone.Name, err)
+	}
+	addresses := make(map[string]*anxcloudDns.Record)
+	for _, record := range records {
+		if !isAddressType(record.Type) || record.Region != "" {
+			continue
+		}
+		address := canonicalRData(record.Type, record.RData)
+		if !deleted[address] {
+			addresses[address] = record
+		}
+	}
+	return addresses, nil
+}
+
+// createdByWebhook checks whether the state store knows the record, without state store no record is known
+func (p *Provider) createdByWebhook(record *anxcloudDns.Record) bool {
+	if p.state == nil || record.Identifier == "" {
+		return false
+	}
+	_, err := p.state.Get(record.Identifier)
+	if err != nil && !errors.Is(err, state.ErrNotFound) {
+		log.Errorf("failed to look up record %s in the state: %v", record.Identifier, err)
+	}
+	return err == nil
+}
+
+// flattenableApex returns the ASCII name and the zone of an apex CNAME endpoint, the zone is nil for other endpoints
+func (p *Provider) flattenableApex(zones *zoneTrie, ep *endpoint.Endpoint) (string, *anxcloudDns.Zone) {
+	if ep.RecordType != endpoint.RecordTypeCNAME || len(ep.Targets) != 1 {
+		return "", nil
+	}
+	return p.apexZone(zones, ep)
+}
+
+// apexZone returns the ASCII name and the zone of an endpoint without set identifier at the apex of a zone, the zone
+// is nil for other endpoints
+func (p *Provider) apexZone(zones *zoneTrie, ep *endpoint.Endpoint) (string, *anxcloudDns.Zone) {
+	if ep.SetIdentifier != "" {
+		return "", nil
+	}
+	asciiName, err := toASCIIName(ep.DNSName)
+	if err != nil {
+		return "", nil
+	}
+	zone, _ := p.resolveZone(zones, asciiName)
+	if zone == nil || normalizeDomainName(zone.Name) != asciiName {
+		return "", nil
+	}
+	return asciiName, zone
+}
+
+// addressEndpoints splits addresses into an A and an AAAA endpoint with the name and TTL of the endpoint
+func addressEndpoints(ep *endpoint.Endpoint, addresses []string) []*endpoint.Endpoint {
+	endpoints := make([]*endpoint.Endpoint, 0, 2)
+	ipv4 := make(endpoint.Targets, 0)
+	ipv6 := make(endpoint.Targets, 0)
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		switch {
+		case ip == nil:
+			continue
+		case ip.To4() != nil:
+			ipv4 = append(ipv4, address)
+		default:
+			ipv6 = append(ipv6, address)
+		}
+	}
+	if len(ipv4) > 0 {
+		endpoints = append(endpoints, &endpoint.Endpoint{DNSName: ep.DNSName, RecordType: endpoint.RecordTypeA, RecordTTL: ep.RecordTTL, Targets: ipv4})
+	}
+	if len(ipv6) > 0 {
+		endpoints = append(endpoints, &endpoint.Endpoint{DNSName: ep.DNSName, RecordType: endpoint.RecordTypeAAAA, RecordTTL: ep.RecordTTL, Targets: ipv6})
+	}
+	return endpoints
+}
+
+func flattenedAddresses(ep *endpoint.Endpoint) []string {
+	value, found := ep.GetProviderSpecificProperty(providerSpecificFlattenedAddresses)
+	if !found || value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func isAddressType(recordType string) bool {
+	return strings.EqualFold(recordType, endpoint.RecordTypeA) || strings.EqualFold(recordType, endpoint.RecordTypeAAAA)
+}
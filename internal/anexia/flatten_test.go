@@ -0,0 +1,259 @@
+package anexia
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// startTestResolver starts a local DNS server answering with the given records, other names are NXDOMAIN
+func startTestResolver(t *testing.T, records map[string][]string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		question := r.Question[0]
+		answers, found := records[question.Name]
+		if !found {
+			response.Rcode = dns.RcodeNameError
+		}
+		for _, answer := range answers {
+			rr, err := dns.NewRR(answer)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			if rr.Header().Rrtype == question.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+				response.Answer = append(response.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(response)
+	})
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+	return conn.LocalAddr().String()
+}
+
+var testResolverRecords = map[string][]string{
+	"lb.example.net.": {
+		"lb.example.net. 60 IN CNAME lb-1.example.net.",
+		"lb-1.example.net. 60 IN A 192.0.2.10",
+		"lb-1.example.net. 60 IN A 192.0.2.11",
+		"lb-1.example.net. 60 IN AAAA 2001:db8::10",
+	},
+	"v4.example.net.": {"v4.example.net. 60 IN A 192.0.2.20"},
+}
+
+func TestFlattenerResolve(t *testing.T) {
+	flattening, err := newFlattener(startTestResolver(t, testResolverRecords), 0, nil)
+	require.NoError(t, err)
+
+	addresses, err := flattening.resolve(context.Background(), "LB.example.net.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.10", "192.0.2.11", "2001:db8::10"}, addresses)
+
+	_, err = flattening.resolve(context.Background(), "missing.example.net")
+	require.EqualError(t, err, "failed to resolve missing.example.net: NXDOMAIN")
+}
+
+func TestFlattenerResolveCachesForInterval(t *testing.T) {
+	records := map[string][]string{"v4.example.net.": {"v4.example.net. 60 IN A 192.0.2.20"}}
+	flattening, err := newFlattener(startTestResolver(t, records), time.Hour, nil)
+	require.NoError(t, err)
+
+	addresses, err := flattening.resolve(context.Background(), "v4.example.net")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.20"}, addresses)
+
+	flattening.resolved["v4.example.net"] = resolution{addresses: []string{"192.0.2.21"}, expires: time.Now().Add(-time.Second)}
+	addresses, err = flattening.resolve(context.Background(), "v4.example.net")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.20"}, addresses, "expired addresses are resolved again")
+}
+
+func TestApplyChangesFlattening(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name             string
+		givenZoneRecords []*anxcloudDns.Record
+		givenStateIDs    []string // records created by the webhook
+		whenChanges      *plan.Changes
+		expectedCreated  []string // type and rdata
+		expectedDeleted  []string // record IDs
+	}{
+		{
+			name: "apex CNAME is flattened",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "lb.example.net")},
+			},
+			expectedCreated: []string{"A 192.0.2.10", "A 192.0.2.11", "AAAA 2001:db8::10"},
+		},
+		{
+			name: "CNAME below the apex is not flattened",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "CNAME", 300, "lb.example.net")},
+			},
+			expectedCreated: []string{"CNAME lb.example.net"},
+		},
+		{
+			name: "unresolvable target is skipped",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "missing.example.net")},
+			},
+		},
+		{
+			name: "existing addresses are kept and stale ones created by the webhook deleted",
+			givenZoneRecords: []*anxcloudDns.Record{
+				{Identifier: "kept", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.10"},
+				{Identifier: "stale", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.99"},
+				{Identifier: "manual", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.98"},
+				{Identifier: "mx", ZoneName: "de", Name: "@", Type: "MX", TTL: 300, RData: "10 mail.de"},
+			},
+			givenStateIDs: []string{"kept", "stale"},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "lb.example.net")},
+			},
+			expectedCreated: []string{"A 192.0.2.11", "AAAA 2001:db8::10"},
+			expectedDeleted: []string{"stale"},
+		},
+		{
+			name: "addresses deleted by the same changes are created again",
+			givenZoneRecords: []*anxcloudDns.Record{
+				{Identifier: "a1", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.10"},
+				{Identifier: "a2", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.11"},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "lb.example.net")},
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "A", 300, "192.0.2.10", "192.0.2.11")},
+			},
+			expectedCreated: []string{"A 192.0.2.10", "A 192.0.2.11", "AAAA 2001:db8::10"},
+			expectedDeleted: []string{"a1", "a2"},
+		},
+		{
+			name: "changed addresses are updated",
+			givenZoneRecords: []*anxcloudDns.Record{
+				{Identifier: "old", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.99"},
+			},
+			whenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net").
+					WithProviderSpecific(providerSpecificFlattenedAddresses, "192.0.2.99")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net").
+					WithProviderSpecific(providerSpecificFlattenedAddresses, "192.0.2.20")},
+			},
+			expectedCreated: []string{"A 192.0.2.20"},
+			expectedDeleted: []string{"old"},
+		},
+		{
+			name: "deleted apex CNAME deletes its addresses",
+			givenZoneRecords: []*anxcloudDns.Record{
+				{Identifier: "a", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.20"},
+			},
+			whenChanges: &plan.Changes{
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net").
+					WithProviderSpecific(providerSpecificFlattenedAddresses, "192.0.2.20")},
+			},
+			expectedDeleted: []string{"a"},
+		},
+	}
+
+	resolver := startTestResolver(t, testResolverRecords)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := state.NewMemoryStore()
+			for _, id := range tc.givenStateIDs {
+				require.NoError(t, store.Put(state.Entry{RecordID: id, ZoneName: "de"}))
+			}
+			flattening, err := newFlattener(resolver, 0, store)
+			require.NoError(t, err)
+			mockDNSClient := &mockDNSClient{
+				allZones:    createZoneSlice(1, func(_ int) string { return "de" }),
+				zoneRecords: map[string][]*anxcloudDns.Record{"de": tc.givenZoneRecords},
+			}
+			provider := &Provider{client: mockDNSClient, state: store, flattening: flattening}
+			require.NoError(t, provider.ApplyChanges(ctx, tc.whenChanges))
+
+			created := make([]string, 0)
+			for _, record := range mockDNSClient.createdRecords["de"] {
+				created = append(created, record.Type+" "+record.RData)
+			}
+			assert.ElementsMatch(t, tc.expectedCreated, created)
+			assert.ElementsMatch(t, tc.expectedDeleted, mockDNSClient.deletedRecords["de"])
+		})
+	}
+}
+
+func TestRecordsFlattening(t *testing.T) {
+	flattening, err := newFlattener(startTestResolver(t, testResolverRecords), 0, nil)
+	require.NoError(t, err)
+	flattening.remember("de", "v4.example.net")
+	mockDNSClient := &mockDNSClient{
+		allRecords: []*anxcloudDns.Record{
+			{Identifier: "1", ZoneName: "de", Name: "@", Type: "A", TTL: 300, RData: "192.0.2.99"},
+			{Identifier: "2", ZoneName: "de", Name: "@", Type: "MX", TTL: 300, RData: "10 mail.de"},
+			{Identifier: "3", ZoneName: "de", Name: "www", Type: "A", TTL: 300, RData: "192.0.2.1"},
+		},
+	}
+	provider := &Provider{client: mockDNSClient, flattening: flattening}
+
+	current, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	require.Len(t, current, 3)
+	assert.Equal(t, &endpoint.Endpoint{
+		DNSName:          "de",
+		RecordType:       "CNAME",
+		RecordTTL:        300,
+		Targets:          endpoint.Targets{"v4.example.net"},
+		ProviderSpecific: endpoint.ProviderSpecific{{Name: providerSpecificFlattenedAddresses, Value: "192.0.2.99"}},
+	}, current[0])
+	assert.Equal(t, "MX", current[1].RecordType)
+	assert.Equal(t, "www.de", current[2].DNSName)
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net")})
+	require.NoError(t, err)
+	value, _ := desired[0].GetProviderSpecificProperty(providerSpecificFlattenedAddresses)
+	assert.Equal(t, "192.0.2.20", value, "the desired endpoint carries the resolved addresses")
+	assert.True(t, endpointsAreDifferent(*current[0], *desired[0]), "changed addresses show up as update")
+}
+
+func TestFlattenerKeepsFlattenedApexesInState(t *testing.T) {
+	resolver := startTestResolver(t, testResolverRecords)
+	store := state.NewMemoryStore()
+	flattening, err := newFlattener(resolver, 0, store)
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{allZones: createZoneSlice(1, func(_ int) string { return "de" })}
+	provider := &Provider{client: mockDNSClient, state: store, flattening: flattening}
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net")},
+	}))
+
+	restarted, err := newFlattener(resolver, 0, store)
+	require.NoError(t, err)
+	target, found := restarted.target("de")
+	assert.True(t, found, "the flattened apex is known after a restart")
+	assert.Equal(t, "v4.example.net", target)
+
+	provider.flattening = restarted
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("de", "CNAME", 300, "v4.example.net")},
+	}))
+	flattened, err := store.ListFlattened()
+	require.NoError(t, err)
+	assert.Empty(t, flattened, "deleted apexes are removed from the state")
+}
@@ -0,0 +1,447 @@
+package anexia
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// provider-specific properties configuring the health check of the targets of an endpoint
+const (
+	// providerSpecificHealthCheck is the type of the check, one of 'tcp', 'http', 'https' or 'dns'
+	providerSpecificHealthCheck = "webhook/anexia-health-check"
+	// providerSpecificHealthCheckPort is the port to check, by default 80 for http, 443 for https and 53 for dns
+	providerSpecificHealthCheckPort = "webhook/anexia-health-check-port"
+	// providerSpecificHealthCheckPath is the path requested by http and https checks, by default '/'
+	providerSpecificHealthCheckPath = "webhook/anexia-health-check-path"
+	// providerSpecificHealthCheckStatus are the healthy status codes of http and https checks, like '200,300-399'
+	providerSpecificHealthCheckStatus = "webhook/anexia-health-check-status"
+	// providerSpecificHealthCheckName is the name queried by dns checks, by default the name of the endpoint
+	providerSpecificHealthCheckName = "webhook/anexia-health-check-name"
+	// providerSpecificWithheldTargets holds the comma separated targets which are not published because they are
+	// unhealthy. Records reports the withheld targets, AdjustEndpoints the unhealthy ones, so a change of the health
+	// of a target shows up as update.
+	providerSpecificWithheldTargets = "webhook/anexia-withheld-targets"
+)
+
+// healthCheckProperties are the properties configuring a health check, Records reports them for checked endpoints
+var healthCheckProperties = []string{
+	providerSpecificHealthCheck,
+	providerSpecificHealthCheckPort,
+	providerSpecificHealthCheckPath,
+	providerSpecificHealthCheckStatus,
+	providerSpecificHealthCheckName,
+}
+
+const (
+	healthCheckTCP   = "tcp"
+	healthCheckHTTP  = "http"
+	healthCheckHTTPS = "https"
+	healthCheckDNS   = "dns"
+)
+
+// healthCheck is the health check configuration of an endpoint
+type healthCheck struct {
+	kind       string
+	port       string
+	path       string
+	statuses   [][2]int
+	queryName  string
+	properties endpoint.ProviderSpecific
+}
+
+// parseHealthCheck reads the health check configuration of an endpoint, it returns nil if none is configured
+func parseHealthCheck(ep *endpoint.Endpoint) (*healthCheck, error) {
+	kind, found := ep.GetProviderSpecificProperty(providerSpecificHealthCheck)
+	if !found || kind == "" {
+		return nil, nil
+	}
+	check := &healthCheck{kind: strings.ToLower(strings.TrimSpace(kind)), path: "/", queryName: ep.DNSName}
+	switch check.kind {
+	case healthCheckTCP:
+	case healthCheckHTTP:
+		check.port = "80"
+	case healthCheckHTTPS:
+		check.port = "443"
+	case healthCheckDNS:
+		check.port = "53"
+	default:
+		return nil, fmt.Errorf("unknown health check '%s', expected one of: tcp, http, https, dns", kind)
+	}
+	if port, found := ep.GetProviderSpecificProperty(providerSpecificHealthCheckPort); found {
+		if number, err := strconv.ParseUint(port, 10, 16); err != nil || number == 0 {
+			return nil, fmt.Errorf("invalid health check port '%s'", port)
+		}
+		check.port = port
+	}
+	if check.port == "" {
+		return nil, errors.New("the tcp health check needs a port")
+	}
+	if path, found := ep.GetProviderSpecificProperty(providerSpecificHealthCheckPath); found {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid health check path '%s', it has to start with '/'", path)
+		}
+		check.path = path
+	}
+	statuses := "200-399"
+	if value, found := ep.GetProviderSpecificProperty(providerSpecificHealthCheckStatus); found {
+		statuses = value
+	}
+	var err error
+	if check.statuses, err = parseStatusRanges(statuses); err != nil {
+		return nil, err
+	}
+	if name, found := ep.GetProviderSpecificProperty(providerSpecificHealthCheckName); found {
+		check.queryName = name
+	}
+	for _, name := range healthCheckProperties {
+		if value, found := ep.GetProviderSpecificProperty(name); found {
+			check.properties = append(check.properties, endpoint.ProviderSpecificProperty{Name: name, Value: value})
+		}
+	}
+	return check, nil
+}
+
+// parseStatusRanges parses comma separated status codes and ranges of status codes
+func parseStatusRanges(value string) ([][2]int, error) {
+	ranges := make([][2]int, 0)
+	for _, part := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			to = from
+		}
+		low, errLow := strconv.Atoi(from)
+		high, errHigh := strconv.Atoi(to)
+		if errLow != nil || errHigh != nil || low < 100 || high > 599 || low > high {
+			return nil, fmt.Errorf("invalid health check status '%s'", part)
+		}
+		ranges = append(ranges, [2]int{low, high})
+	}
+	return ranges, nil
+}
+
+// run checks a single target
+func (c *healthCheck) run(ctx context.Context, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	address := net.JoinHostPort(strings.TrimSuffix(target, "."), c.port)
+	switch c.kind {
+	case healthCheckTCP:
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case healthCheckHTTP, healthCheckHTTPS:
+		return c.runHTTP(ctx, address)
+	case healthCheckDNS:
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(c.queryName), dns.TypeA)
+		response, _, err := (&dns.Client{Timeout: timeout}).ExchangeContext(ctx, msg, address)
+		if err != nil {
+			return err
+		}
+		if response.Rcode != dns.RcodeSuccess {
+			return fmt.Errorf("answered with %s", dns.RcodeToString[response.Rcode])
+		}
+	}
+	return nil
+}
+
+// runHTTP requests the path from the target with the name of the endpoint as host
+func (c *healthCheck) runHTTP(ctx context.Context, address string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.kind+"://"+address+c.path, nil)
+	if err != nil {
+		return err
+	}
+	request.Host = c.queryName
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: c.queryName, MinVersion: tls.VersionTLS12}},
+		// a redirect is an answer of the target itself
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	defer client.CloseIdleConnections()
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	for _, statuses := range c.statuses {
+		if response.StatusCode >= statuses[0] && response.StatusCode <= statuses[1] {
+			return nil
+		}
+	}
+	return fmt.Errorf("answered with status %d", response.StatusCode)
+}
+
+// targetHealth is the health of a single target. A target only changes its health after a number of consecutive
+// results, so a flapping target does not cause a change on every check.
+type targetHealth struct {
+	healthy   bool
+	successes int
+	failures  int
+}
+
+// checkedEndpoint is an endpoint with health check, as seen by the last call of AdjustEndpoints
+type checkedEndpoint struct {
+	check   *healthCheck
+	targets endpoint.Targets
+}
+
+// healthChecker periodically checks the targets of the endpoints with health check in the background
+type healthChecker struct {
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+
+	mu        sync.Mutex
+	endpoints map[string]*checkedEndpoint
+	// health holds the health of the targets by endpoint key and target
+	health map[string]map[string]*targetHealth
+}
+
+func newHealthChecker(interval, timeout time.Duration, healthyThreshold, unhealthyThreshold int) (*healthChecker, error) {
+	if timeout <= 0 || healthyThreshold < 1 || unhealthyThreshold < 1 {
+		return nil, errors.New("the health check timeout and thresholds have to be positive")
+	}
+	return &healthChecker{
+		interval:           interval,
+		timeout:            timeout,
+		healthyThreshold:   healthyThreshold,
+		unhealthyThreshold: unhealthyThreshold,
+		endpoints:          make(map[string]*checkedEndpoint),
+		health:             make(map[string]map[string]*targetHealth),
+	}, nil
+}
+
+// register replaces the checked endpoints with the endpoints with health check among the desired endpoints.
+// Endpoints with invalid configuration are published without health check.
+func (h *healthChecker) register(endpoints []*endpoint.Endpoint) {
+	checked := make(map[string]*checkedEndpoint)
+	for _, ep := range endpoints {
+		check, err := parseHealthCheck(ep)
+		if err != nil {
+			log.Warnf("publishing %s record %s without health check: %v", ep.RecordType, ep.DNSName, err)
+			continue
+		}
+		if check != nil {
+			checked[endpointKey(ep)] = &checkedEndpoint{check: check, targets: append(endpoint.Targets{}, ep.Targets...)}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.endpoints = checked
+	// forget the health and the metric series of targets and endpoints which are not checked anymore
+	for key, targets := range h.health {
+		checkedEndpoint, found := checked[key]
+		for target := range targets {
+			if found && slices.Contains(checkedEndpoint.targets, target) {
+				continue
+			}
+			delete(targets, target)
+			healthyTargetsGauge.DeleteLabelValues(key, target)
+		}
+		if len(targets) == 0 {
+			delete(h.health, key)
+		}
+	}
+}
+
+// checkAll runs the checks of all targets concurrently and updates their health
+func (h *healthChecker) checkAll(ctx context.Context) {
+	h.mu.Lock()
+	type job struct {
+		endpointKey, target string
+		check               *healthCheck
+	}
+	jobs := make([]job, 0)
+	for key, checked := range h.endpoints {
+		for _, target := range checked.targets {
+			jobs = append(jobs, job{endpointKey: key, target: target, check: checked.check})
+		}
+	}
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j job) {
+			defer wg.Done()
+			err := j.check.run(ctx, j.target, h.timeout)
+			result := "success"
+			if err != nil {
+				result = "failure"
+				log.Debugf("health check of target %s of %s failed: %v", j.target, j.endpointKey, err)
+			}
+			healthChecksCounter.WithLabelValues(j.check.kind, result).Inc()
+			h.record(j.endpointKey, j.target, err == nil)
+		}(j)
+	}
+	wg.Wait()
+}
+
+// record updates the health of a target with the result of a check
+func (h *healthChecker) record(endpointKey, target string, success bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, found := h.endpoints[endpointKey]; !found {
+		// the endpoint was removed while it was checked
+		return
+	}
+	if h.health[endpointKey] == nil {
+		h.health[endpointKey] = make(map[string]*targetHealth)
+	}
+	health, found := h.health[endpointKey][target]
+	if !found {
+		health = &targetHealth{healthy: true}
+		h.health[endpointKey][target] = health
+	}
+	if success {
+		health.successes++
+		health.failures = 0
+		if !health.healthy && health.successes >= h.healthyThreshold {
+			health.healthy = true
+			log.Infof("target %s of %s is healthy again", target, endpointKey)
+			healthTransitionsCounter.WithLabelValues("healthy").Inc()
+		}
+	} else {
+		health.failures++
+		health.successes = 0
+		if health.healthy && health.failures >= h.unhealthyThreshold {
+			health.healthy = false
+			log.Warnf("target %s of %s is unhealthy", target, endpointKey)
+			healthTransitionsCounter.WithLabelValues("unhealthy").Inc()
+		}
+	}
+	value := 0.0
+	if health.healthy {
+		value = 1
+	}
+	healthyTargetsGauge.WithLabelValues(endpointKey, target).Set(value)
+}
+
+// unhealthyTargets returns the sorted targets of an endpoint which have to be withheld. Targets which were not
+// checked yet count as healthy. If no target is healthy, none is withheld, as publishing all targets is better than
+// publishing none.
+func (h *healthChecker) unhealthyTargets(ep *endpoint.Endpoint) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := endpointKey(ep)
+	if _, found := h.endpoints[key]; !found {
+		return nil
+	}
+	unhealthy := make([]string, 0)
+	for _, target := range ep.Targets {
+		if health, found := h.health[key][target]; found && !health.healthy {
+			unhealthy = append(unhealthy, target)
+		}
+	}
+	if len(unhealthy) == len(ep.Targets) {
+		if len(unhealthy) > 0 {
+			log.Warnf("all targets of %s record %s are unhealthy, publishing all of them", ep.RecordType, ep.DNSName)
+		}
+		return nil
+	}
+	sort.Strings(unhealthy)
+	return unhealthy
+}
+
+// adjust sets the unhealthy targets of a desired endpoint
+func (h *healthChecker) adjust(ep *endpoint.Endpoint) {
+	ep.DeleteProviderSpecificProperty(providerSpecificWithheldTargets)
+	if unhealthy := h.unhealthyTargets(ep); len(unhealthy) > 0 {
+		ep.SetProviderSpecificProperty(providerSpecificWithheldTargets, strings.Join(unhealthy, ","))
+	}
+}
+
+// withhold returns a copy of an endpoint to create without its unhealthy targets
+func (h *healthChecker) withhold(ep *endpoint.Endpoint) *endpoint.Endpoint {
+	unhealthy := h.unhealthyTargets(ep)
+	if len(unhealthy) == 0 {
+		return ep
+	}
+	withheld := make(map[string]bool, len(unhealthy))
+	for _, target := range unhealthy {
+		withheld[target] = true
+	}
+	healthy := *ep
+	healthy.Targets = make(endpoint.Targets, 0, len(ep.Targets))
+	for _, target := range ep.Targets {
+		if !withheld[target] {
+			healthy.Targets = append(healthy.Targets, target)
+		}
+	}
+	log.Infof("withholding the unhealthy targets %s of %s record %s", strings.Join(unhealthy, ", "), ep.RecordType, ep.DNSName)
+	return &healthy
+}
+
+// report adds the withheld targets and the health check configuration to the current endpoints with health check,
+// so they compare equal to the desired endpoints as long as the health of the targets does not change
+func (h *healthChecker) report(endpoints []*endpoint.Endpoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ep := range endpoints {
+		checked, found := h.endpoints[endpointKey(ep)]
+		if !found {
+			continue
+		}
+		for _, property := range checked.check.properties {
+			ep.SetProviderSpecificProperty(property.Name, property.Value)
+		}
+		published := make(map[string]bool, len(ep.Targets))
+		for _, target := range ep.Targets {
+			published[canonicalRData(ep.RecordType, target)] = true
+		}
+		withheld := make([]string, 0)
+		for _, target := range checked.targets {
+			if !published[canonicalRData(ep.RecordType, target)] {
+				withheld = append(withheld, target)
+			}
+		}
+		if len(withheld) == 0 || len(withheld) == len(checked.targets) {
+			continue
+		}
+		sort.Strings(withheld)
+		ep.Targets = append(ep.Targets, withheld...)
+		sort.Strings(ep.Targets)
+		ep.SetProviderSpecificProperty(providerSpecificWithheldTargets, strings.Join(withheld, ","))
+	}
+}
+
+// StartHealthChecks periodically checks the targets of the endpoints with health check until the context is done.
+// It does nothing if health checks are not enabled.
+func (p *Provider) StartHealthChecks(ctx context.Context) {
+	if p.health == nil {
+		return
+	}
+	log.Infof("starting health checks every %s", p.health.interval)
+
+	go func() {
+		ticker := time.NewTicker(p.health.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Info("stopping health checks")
+				return
+			case <-ticker.C:
+				p.health.checkAll(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,283 @@
+package anexia
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	testCases := []struct {
+		name            string
+		givenProperties map[string]string
+		expectedCheck   *healthCheck
+		expectedError   string
+	}{
+		{
+			name:            "no health check",
+			givenProperties: map[string]string{},
+		},
+		{
+			name:            "http with defaults",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "HTTP"},
+			expectedCheck:   &healthCheck{kind: "http", port: "80", path: "/", statuses: [][2]int{{200, 399}}, queryName: "www.de"},
+		},
+		{
+			name: "https with path and status codes",
+			givenProperties: map[string]string{
+				providerSpecificHealthCheck:       "https",
+				providerSpecificHealthCheckPath:   "/healthz",
+				providerSpecificHealthCheckStatus: "200, 204-206",
+			},
+			expectedCheck: &healthCheck{kind: "https", port: "443", path: "/healthz", statuses: [][2]int{{200, 200}, {204, 206}}, queryName: "www.de"},
+		},
+		{
+			name: "dns with query name",
+			givenProperties: map[string]string{
+				providerSpecificHealthCheck:     "dns",
+				providerSpecificHealthCheckName: "probe.de",
+			},
+			expectedCheck: &healthCheck{kind: "dns", port: "53", path: "/", statuses: [][2]int{{200, 399}}, queryName: "probe.de"},
+		},
+		{
+			name:            "tcp without port",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "tcp"},
+			expectedError:   "the tcp health check needs a port",
+		},
+		{
+			name:            "unknown type",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "icmp"},
+			expectedError:   "unknown health check 'icmp', expected one of: tcp, http, https, dns",
+		},
+		{
+			name:            "invalid port",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "tcp", providerSpecificHealthCheckPort: "70000"},
+			expectedError:   "invalid health check port '70000'",
+		},
+		{
+			name:            "invalid path",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "http", providerSpecificHealthCheckPath: "healthz"},
+			expectedError:   "invalid health check path 'healthz', it has to start with '/'",
+		},
+		{
+			name:            "invalid status",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "http", providerSpecificHealthCheckStatus: "300-200"},
+			expectedError:   "invalid health check status '300-200'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ep := endpoint.NewEndpoint("www.de", "A", "192.0.2.1")
+			for name, value := range tc.givenProperties {
+				ep.SetProviderSpecificProperty(name, value)
+			}
+			check, err := parseHealthCheck(ep)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if check != nil {
+				check.properties = nil
+			}
+			assert.Equal(t, tc.expectedCheck, check)
+		})
+	}
+}
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	testCases := []struct {
+		name            string
+		whenResults     []bool
+		expectedHealthy bool
+	}{
+		{name: "single failure is tolerated", whenResults: []bool{false, true, false, false, true}, expectedHealthy: true},
+		{name: "consecutive failures make unhealthy", whenResults: []bool{true, false, false, false}, expectedHealthy: false},
+		{name: "single success is not enough to recover", whenResults: []bool{false, false, false, true}, expectedHealthy: false},
+		{name: "consecutive successes recover", whenResults: []bool{false, false, false, true, true}, expectedHealthy: true},
+		{name: "flapping target stays unhealthy", whenResults: []bool{false, false, false, true, false, true, false}, expectedHealthy: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker, err := newHealthChecker(time.Minute, time.Second, 2, 3)
+			require.NoError(t, err)
+			ep := endpoint.NewEndpoint("www.de", "A", "192.0.2.1", "192.0.2.2").WithProviderSpecific(providerSpecificHealthCheck, "http")
+			checker.register([]*endpoint.Endpoint{ep})
+			for _, result := range tc.whenResults {
+				checker.record(endpointKey(ep), "192.0.2.1", result)
+			}
+			if tc.expectedHealthy {
+				assert.Empty(t, checker.unhealthyTargets(ep))
+			} else {
+				assert.Equal(t, []string{"192.0.2.1"}, checker.unhealthyTargets(ep))
+			}
+		})
+	}
+}
+
+func TestHealthCheckerKeepsAllTargetsIfNoneIsHealthy(t *testing.T) {
+	checker, err := newHealthChecker(time.Minute, time.Second, 1, 1)
+	require.NoError(t, err)
+	ep := endpoint.NewEndpoint("www.de", "A", "192.0.2.1", "192.0.2.2").WithProviderSpecific(providerSpecificHealthCheck, "http")
+	checker.register([]*endpoint.Endpoint{ep})
+	checker.record(endpointKey(ep), "192.0.2.1", false)
+	checker.record(endpointKey(ep), "192.0.2.2", false)
+	assert.Empty(t, checker.unhealthyTargets(ep))
+	assert.Same(t, ep, checker.withhold(ep))
+}
+
+func TestHealthCheckerForgetsRemovedTargets(t *testing.T) {
+	checker, err := newHealthChecker(time.Minute, time.Second, 1, 1)
+	require.NoError(t, err)
+	ep := endpoint.NewEndpoint("forget.de", "A", "192.0.2.1", "192.0.2.2").WithProviderSpecific(providerSpecificHealthCheck, "http")
+	other := endpoint.NewEndpoint("other.forget.de", "A", "192.0.2.3").WithProviderSpecific(providerSpecificHealthCheck, "http")
+	checker.register([]*endpoint.Endpoint{ep, other})
+	checker.record(endpointKey(ep), "192.0.2.1", true)
+	checker.record(endpointKey(ep), "192.0.2.2", false)
+	checker.record(endpointKey(other), "192.0.2.3", true)
+
+	// one target of the first endpoint and the second endpoint go away
+	updated := endpoint.NewEndpoint("forget.de", "A", "192.0.2.1").WithProviderSpecific(providerSpecificHealthCheck, "http")
+	checker.register([]*endpoint.Endpoint{updated})
+
+	assert.Equal(t, map[string]map[string]*targetHealth{
+		endpointKey(ep): {"192.0.2.1": {healthy: true, successes: 1}},
+	}, checker.health)
+	// deleting reports whether the series existed
+	assert.False(t, healthyTargetsGauge.DeleteLabelValues(endpointKey(ep), "192.0.2.2"))
+	assert.False(t, healthyTargetsGauge.DeleteLabelValues(endpointKey(other), "192.0.2.3"))
+	assert.True(t, healthyTargetsGauge.DeleteLabelValues(endpointKey(ep), "192.0.2.1"))
+}
+
+func TestHealthCheckerCheckAll(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "www.de" || r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer httpServer.Close()
+	httpURL, err := url.Parse(httpServer.URL)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	_, dnsPort, err := net.SplitHostPort(startTestResolver(t, map[string][]string{"www.de.": {"www.de. 60 IN A 192.0.2.1"}}))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		givenProperties map[string]string
+		expectedHealthy bool
+	}{
+		{
+			name:            "http check succeeds",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "http", providerSpecificHealthCheckPort: httpURL.Port(), providerSpecificHealthCheckPath: "/healthz"},
+			expectedHealthy: true,
+		},
+		{
+			name:            "http check with unexpected status fails",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "http", providerSpecificHealthCheckPort: httpURL.Port(), providerSpecificHealthCheckPath: "/other"},
+			expectedHealthy: false,
+		},
+		{
+			name:            "tcp check succeeds",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "tcp", providerSpecificHealthCheckPort: portOf(t, listener.Addr())},
+			expectedHealthy: true,
+		},
+		{
+			name:            "tcp check of a closed port fails",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "tcp", providerSpecificHealthCheckPort: portOf(t, closed.Addr())},
+			expectedHealthy: false,
+		},
+		{
+			name:            "dns check succeeds",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "dns", providerSpecificHealthCheckPort: dnsPort},
+			expectedHealthy: true,
+		},
+		{
+			name:            "dns check of an unknown name fails",
+			givenProperties: map[string]string{providerSpecificHealthCheck: "dns", providerSpecificHealthCheckPort: dnsPort, providerSpecificHealthCheckName: "other.de"},
+			expectedHealthy: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker, err := newHealthChecker(time.Minute, 2*time.Second, 1, 1)
+			require.NoError(t, err)
+			ep := endpoint.NewEndpoint("www.de", "A", "127.0.0.1")
+			for name, value := range tc.givenProperties {
+				ep.SetProviderSpecificProperty(name, value)
+			}
+			checker.register([]*endpoint.Endpoint{ep})
+			checker.checkAll(context.Background())
+
+			health := checker.health[endpointKey(ep)]["127.0.0.1"]
+			require.NotNil(t, health)
+			assert.Equal(t, tc.expectedHealthy, health.healthy)
+		})
+	}
+}
+
+func portOf(t *testing.T, addr net.Addr) string {
+	t.Helper()
+	_, port, err := net.SplitHostPort(addr.String())
+	require.NoError(t, err)
+	return port
+}
+
+func TestApplyChangesWithholdsUnhealthyTargets(t *testing.T) {
+	ctx := context.Background()
+	checker, err := newHealthChecker(time.Minute, time.Second, 1, 1)
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{allZones: createZoneSlice(1, func(_ int) string { return "de" })}
+	provider := &Provider{client: mockDNSClient, health: checker}
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.1", "192.0.2.2").WithProviderSpecific(providerSpecificHealthCheck, "http"),
+	})
+	require.NoError(t, err)
+	checker.record(endpointKey(desired[0]), "192.0.2.2", false)
+	desired, err = provider.AdjustEndpoints(desired)
+	require.NoError(t, err)
+	value, _ := desired[0].GetProviderSpecificProperty(providerSpecificWithheldTargets)
+	assert.Equal(t, "192.0.2.2", value)
+
+	require.NoError(t, provider.ApplyChanges(ctx, &plan.Changes{Create: desired}))
+	require.Len(t, mockDNSClient.createdRecords["de"], 1)
+	assert.Equal(t, "192.0.2.1", mockDNSClient.createdRecords["de"][0].RData)
+	assert.Equal(t, endpoint.Targets{"192.0.2.1", "192.0.2.2"}, desired[0].Targets, "the desired endpoint is not changed")
+
+	// Records reports the withheld target, so the plan converges
+	mockDNSClient.allRecords = []*anxcloudDns.Record{mockDNSClient.createdRecords["de"][0]}
+	current, err := provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, current, 1)
+	assert.Equal(t, endpoint.Targets{"192.0.2.1", "192.0.2.2"}, current[0].Targets)
+	assert.False(t, endpointsAreDifferent(*current[0], *desired[0]))
+	health, _ := current[0].GetProviderSpecificProperty(providerSpecificHealthCheck)
+	assert.Equal(t, "http", health)
+
+	// the target recovers, which shows up as update
+	checker.record(endpointKey(desired[0]), "192.0.2.2", true)
+	desired, err = provider.AdjustEndpoints(desired)
+	require.NoError(t, err)
+	assert.True(t, endpointsAreDifferent(*current[0], *desired[0]))
+}
@@ -0,0 +1,81 @@
+package anexia
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxLabelLength      = 63
+	maxDomainNameLength = 253
+)
+
+// ErrInvalidName is wrapped by the errors for names which are no valid domain names
+var ErrInvalidName = errors.New("invalid domain name")
+
+// idnaProfile converts names according to IDNA2008. Underscores and wildcards are not allowed in host names,
+// but they are in DNS names, so the strict domain name rules are replaced by validateASCIIName.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+	idna.Transitional(false),
+)
+
+// toASCIIName converts the domain name to lower case A-labels, the form which is used for zone matching and the API
+func toASCIIName(name string) (string, error) {
+	asciiName, err := idnaProfile.ToASCII(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return "", fmt.Errorf("%w '%s': %w", ErrInvalidName, name, err)
+	}
+	if err := validateASCIIName(asciiName); err != nil {
+		return "", fmt.Errorf("%w '%s': %w", ErrInvalidName, name, err)
+	}
+	return asciiName, nil
+}
+
+// toUnicodeName converts the domain name to lower case U-labels, the form in which endpoints are returned
+func toUnicodeName(name string) (string, error) {
+	asciiName, err := toASCIIName(name)
+	if err != nil {
+		return "", err
+	}
+	unicodeName, err := idnaProfile.ToUnicode(asciiName)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain name '%s': %w", name, err)
+	}
+	return unicodeName, nil
+}
+
+// validateASCIIName checks the length and the characters of the labels of an A-label domain name
+func validateASCIIName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > maxDomainNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxDomainNameLength)
+	}
+	for i, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("empty label")
+		}
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("label '%s' is longer than %d characters", label, maxLabelLength)
+		}
+		if label == "*" {
+			if i != 0 {
+				return fmt.Errorf("wildcard label is only allowed as the first label")
+			}
+			continue
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Errorf("label '%s' contains the invalid character '%c'", label, r)
+			}
+		}
+	}
+	return nil
+}
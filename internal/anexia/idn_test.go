@@ -0,0 +1,125 @@
+package anexia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDNAConversion(t *testing.T) {
+	testCases := []struct {
+		name                string
+		givenName           string
+		expectedASCIIName   string
+		expectedUnicodeName string
+		expectedError       string
+	}{
+		{
+			name:                "ascii name",
+			givenName:           "www.example.com",
+			expectedASCIIName:   "www.example.com",
+			expectedUnicodeName: "www.example.com",
+		},
+		{
+			name:                "upper case and trailing dot",
+			givenName:           "WWW.Example.COM.",
+			expectedASCIIName:   "www.example.com",
+			expectedUnicodeName: "www.example.com",
+		},
+		{
+			name:                "unicode labels",
+			givenName:           "Shop.Bücher.de",
+			expectedASCIIName:   "shop.xn--bcher-kva.de",
+			expectedUnicodeName: "shop.bücher.de",
+		},
+		{
+			name:                "punycode labels",
+			givenName:           "shop.xn--bcher-kva.de",
+			expectedASCIIName:   "shop.xn--bcher-kva.de",
+			expectedUnicodeName: "shop.bücher.de",
+		},
+		{
+			name:                "IDNA2008 keeps the sharp s",
+			givenName:           "straße.de",
+			expectedASCIIName:   "xn--strae-oqa.de",
+			expectedUnicodeName: "straße.de",
+		},
+		{
+			name:                "full width characters are mapped",
+			givenName:           "ＷＷＷ.example.com",
+			expectedASCIIName:   "www.example.com",
+			expectedUnicodeName: "www.example.com",
+		},
+		{
+			name:                "wildcard and underscore labels",
+			givenName:           "*._acme-challenge.bücher.de",
+			expectedASCIIName:   "*._acme-challenge.xn--bcher-kva.de",
+			expectedUnicodeName: "*._acme-challenge.bücher.de",
+		},
+		{
+			name:          "empty name",
+			givenName:     "",
+			expectedError: "invalid domain name '': empty name",
+		},
+		{
+			name:          "empty label",
+			givenName:     "a..example.com",
+			expectedError: "invalid domain name 'a..example.com': empty label",
+		},
+		{
+			name:          "leading hyphen",
+			givenName:     "-a.example.com",
+			expectedError: "invalid domain name '-a.example.com': idna: invalid label \"-a\"",
+		},
+		{
+			name:          "disallowed code point",
+			givenName:     "a\u200d.example.com",
+			expectedError: "invalid domain name 'a\u200d.example.com': idna: invalid label \"a\\u200d\"",
+		},
+		{
+			name:          "space in label",
+			givenName:     "a b.example.com",
+			expectedError: "invalid domain name 'a b.example.com': label 'a b' contains the invalid character ' '",
+		},
+		{
+			name:          "wildcard inside the name",
+			givenName:     "a.*.example.com",
+			expectedError: "invalid domain name 'a.*.example.com': wildcard label is only allowed as the first label",
+		},
+		{
+			name:          "label too long",
+			givenName:     strings.Repeat("a", 64) + ".example.com",
+			expectedError: "invalid domain name '" + strings.Repeat("a", 64) + ".example.com': label '" + strings.Repeat("a", 64) + "' is longer than 63 characters",
+		},
+		{
+			name:          "name too long",
+			givenName:     strings.Repeat("a.", 127) + "de",
+			expectedError: "invalid domain name '" + strings.Repeat("a.", 127) + "de': name is longer than 253 characters",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			asciiName, err := toASCIIName(tc.givenName)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				_, err = toUnicodeName(tc.givenName)
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedASCIIName, asciiName)
+
+			unicodeName, err := toUnicodeName(tc.givenName)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedUnicodeName, unicodeName)
+
+			// both forms convert into each other
+			roundTrip, err := toASCIIName(unicodeName)
+			require.NoError(t, err)
+			assert.Equal(t, asciiName, roundTrip)
+		})
+	}
+}
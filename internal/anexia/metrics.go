@@ -0,0 +1,81 @@
+package anexia
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "external_dns_anexia"
+
+var (
+	driftRecordsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "drift",
+		Name:      "records",
+		Help:      "Number of records which differ from the last applied state, by kind of drift.",
+	}, []string{"kind"})
+	driftChecksCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "drift",
+		Name:      "checks_total",
+		Help:      "Number of drift checks, by result.",
+	}, []string{"result"})
+	driftRepairsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "drift",
+		Name:      "repairs_total",
+		Help:      "Number of drift repairs, by result.",
+	}, []string{"result"})
+	cnameConflictsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "plan",
+		Name:      "cname_conflicts_total",
+		Help:      "Number of endpoints which were not created because of a CNAME conflict, by reason.",
+	}, []string{"reason"})
+	delegatedEndpointsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "plan",
+		Name:      "delegated_endpoints_total",
+		Help:      "Number of endpoints which were not created because their name is delegated to other nameservers.",
+	})
+	existingRecordsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "plan",
+		Name:      "existing_records_total",
+		Help:      "Number of records which were not created because they exist already, by action taken instead.",
+	}, []string{"action"})
+	ptrChangesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "ptr",
+		Name:      "changes_total",
+		Help:      "Number of derived PTR record changes, by action.",
+	}, []string{"action"})
+	healthChecksCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "health",
+		Name:      "checks_total",
+		Help:      "Number of target health checks, by type of check and result.",
+	}, []string{"type", "result"})
+	healthTransitionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "health",
+		Name:      "transitions_total",
+		Help:      "Number of times a target became healthy or unhealthy, by new state.",
+	}, []string{"state"})
+	healthyTargetsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "health",
+		Name:      "target_healthy",
+		Help:      "Whether a checked target is healthy (1) or unhealthy (0), by endpoint and target.",
+	}, []string{"endpoint", "target"})
+	flatteningCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "flattening",
+		Name:      "cnames_total",
+		Help:      "Number of apex CNAME endpoints which were flattened to A and AAAA records.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(driftRecordsGauge, driftChecksCounter, driftRepairsCounter, cnameConflictsCounter, ptrChangesCounter, flatteningCounter,
+		healthChecksCounter, healthTransitionsCounter, healthyTargetsGauge, delegatedEndpointsCounter, existingRecordsCounter)
+}
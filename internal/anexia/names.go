@@ -0,0 +1,37 @@
+package anexia
+
+import (
+	"strings"
+)
+
+// apexRecordName is the record name Anexia uses for the apex of a zone
+const apexRecordName = "@"
+
+// recordName maps a domain name to the name of the record within the zone. The apex of the zone is mapped to '@',
+// all other labels including wildcards are kept as they are. The domain name has to belong to the zone.
+func recordName(domainName, zoneName string) string {
+	name := strings.TrimSuffix(domainName, ".")
+	zone := strings.TrimSuffix(zoneName, ".")
+	if strings.EqualFold(name, zone) {
+		return apexRecordName
+	}
+	// compare case-insensitive but keep the case of the record labels
+	if len(name) > len(zone) && strings.EqualFold(name[len(name)-len(zone)-1:], "."+zone) {
+		return name[:len(name)-len(zone)-1]
+	}
+	return name
+}
+
+// domainName maps the name of a record within the zone back to the domain name, it is the inverse of recordName
+func domainName(recordName, zoneName string) string {
+	zone := strings.TrimSuffix(zoneName, ".")
+	if isApexRecordName(recordName) {
+		return zone
+	}
+	return recordName + "." + zone
+}
+
+// isApexRecordName reports whether the record name denotes the apex of the zone
+func isApexRecordName(recordName string) bool {
+	return recordName == apexRecordName || recordName == ""
+}
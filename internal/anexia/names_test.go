@@ -0,0 +1,98 @@
+package anexia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+func TestRecordNameRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name               string
+		givenDomainName    string
+		givenZoneName      string
+		expectedRecordName string
+		expectedDomainName string
+	}{
+		{
+			name:               "apex",
+			givenDomainName:    "example.com",
+			givenZoneName:      "example.com",
+			expectedRecordName: "@",
+			expectedDomainName: "example.com",
+		},
+		{
+			name:               "apex with trailing dots and different case",
+			givenDomainName:    "Example.COM.",
+			givenZoneName:      "example.com.",
+			expectedRecordName: "@",
+			expectedDomainName: "example.com",
+		},
+		{
+			name:               "record in the zone",
+			givenDomainName:    "www.example.com",
+			givenZoneName:      "example.com",
+			expectedRecordName: "www",
+			expectedDomainName: "www.example.com",
+		},
+		{
+			name:               "record with multiple labels",
+			givenDomainName:    "a.b.example.com.",
+			givenZoneName:      "example.com",
+			expectedRecordName: "a.b",
+			expectedDomainName: "a.b.example.com",
+		},
+		{
+			name:               "record with a different case than the zone",
+			givenDomainName:    "WWW.EXAMPLE.COM",
+			givenZoneName:      "example.com",
+			expectedRecordName: "WWW",
+			expectedDomainName: "WWW.example.com",
+		},
+		{
+			name:               "wildcard below the apex",
+			givenDomainName:    "*.example.com",
+			givenZoneName:      "example.com",
+			expectedRecordName: "*",
+			expectedDomainName: "*.example.com",
+		},
+		{
+			name:               "wildcard in a subdomain",
+			givenDomainName:    "*.apps.example.com",
+			givenZoneName:      "example.com",
+			expectedRecordName: "*.apps",
+			expectedDomainName: "*.apps.example.com",
+		},
+		{
+			name:               "record in a nested zone",
+			givenDomainName:    "www.dev.example.com",
+			givenZoneName:      "dev.example.com",
+			expectedRecordName: "www",
+			expectedDomainName: "www.dev.example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actualRecordName := recordName(tc.givenDomainName, tc.givenZoneName)
+			assert.Equal(t, tc.expectedRecordName, actualRecordName)
+
+			actualDomainName := domainName(actualRecordName, tc.givenZoneName)
+			assert.Equal(t, tc.expectedDomainName, actualDomainName)
+
+			// reading the record back results in the same, normalized endpoint name
+			ep := recordToEndpoint(&anxcloudDns.Record{Name: actualRecordName, ZoneName: tc.givenZoneName})
+			assert.Equal(t, strings.ToLower(actualDomainName), ep.DNSName)
+			assert.Equal(t, strings.ToLower(actualRecordName), recordName(ep.DNSName, tc.givenZoneName))
+		})
+	}
+}
+
+func TestDomainNameOfEmptyRecordName(t *testing.T) {
+	assert.Equal(t, "example.com", domainName("", "example.com"))
+	assert.True(t, isApexRecordName(""))
+	assert.True(t, isApexRecordName("@"))
+	assert.False(t, isApexRecordName("www"))
+}
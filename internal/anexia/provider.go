@@ -3,9 +3,13 @@ package anexia
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
 	log "github.com/sirupsen/logrus"
 	"go.anx.io/go-anxcloud/pkg/api"
 	"go.anx.io/go-anxcloud/pkg/api/types"
@@ -24,10 +28,12 @@ type DNSClient struct {
 type DNSService interface {
 	GetZones(ctx context.Context) ([]*anxcloudDns.Zone, error)
 	GetRecords(ctx context.Context) ([]*anxcloudDns.Record, error)
+	GetZoneRecords(ctx context.Context, zoneName string) ([]*anxcloudDns.Record, error)
 	GetRecordsByZoneNameAndName(ctx context.Context, zoneName, name string) ([]*anxcloudDns.Record, error)
 	GetZonesByDomainName(ctx context.Context, domainName string) ([]*anxcloudDns.Zone, error)
 	DeleteRecord(ctx context.Context, zoneName, recordID string) error
 	CreateRecord(ctx context.Context, zoneName string, record *anxcloudDns.Record) error
+	UpdateRecord(ctx context.Context, zoneName string, record *anxcloudDns.Record) error
 }
 
 func (c *DNSClient) GetZones(ctx context.Context) ([]*anxcloudDns.Zone, error) {
@@ -39,10 +45,9 @@ func (c *DNSClient) GetZones(ctx context.Context) ([]*anxcloudDns.Zone, error) {
 		return nil, err
 	}
 
-	zone := anxcloudDns.Zone{}
-
 	zones := make([]*anxcloudDns.Zone, 0)
 	for res := range channel {
+		zone := anxcloudDns.Zone{}
 		if err := res(&zone); err != nil {
 			log.Errorf("failed to parse zone: %v", err)
 			return nil, err
@@ -55,7 +60,6 @@ func (c *DNSClient) GetZones(ctx context.Context) ([]*anxcloudDns.Zone, error) {
 
 func (c *DNSClient) GetRecords(ctx context.Context) ([]*anxcloudDns.Record, error) {
 	log.Debugf("get all records ...")
-	channel := make(types.ObjectChannel)
 
 	allZones, err := c.GetZones(ctx)
 	if err != nil {
@@ -63,14 +67,25 @@ func (c *DNSClient) GetRecords(ctx context.Context) ([]*anxcloudDns.Record, erro
 		return nil, err
 	}
 
+	records := make([]*anxcloudDns.Record, 0)
 	for _, zone := range allZones {
-		log.Debugf("get records for zone %s ...", zone.Name)
-		zoneName := zone.Name
-
-		if err := c.client.List(ctx, &anxcloudDns.Record{ZoneName: zoneName}, api.ObjectChannel(&channel)); err != nil {
-			log.Errorf("failed to list records for zone %s: %v", zoneName, err)
+		zoneRecords, err := c.GetZoneRecords(ctx, zone.Name)
+		if err != nil {
 			return nil, err
 		}
+		records = append(records, zoneRecords...)
+	}
+
+	return records, nil
+}
+
+func (c *DNSClient) GetZoneRecords(ctx context.Context, zoneName string) ([]*anxcloudDns.Record, error) {
+	log.Debugf("get records for zone %s ...", zoneName)
+	channel := make(types.ObjectChannel)
+
+	if err := c.client.List(ctx, &anxcloudDns.Record{ZoneName: zoneName}, api.ObjectChannel(&channel)); err != nil {
+		log.Errorf("failed to list records for zone %s: %v", zoneName, err)
+		return nil, err
 	}
 
 	records := make([]*anxcloudDns.Record, 0)
@@ -80,6 +95,7 @@ func (c *DNSClient) GetRecords(ctx context.Context) ([]*anxcloudDns.Record, erro
 			log.Errorf("failed to parse record: %v", err)
 			return nil, err
 		}
+		record.ZoneName = zoneName
 		records = append(records, &record)
 	}
 
@@ -95,14 +111,14 @@ func (c *DNSClient) GetRecordsByZoneNameAndName(ctx context.Context, zoneName, n
 		return nil, err
 	}
 
-	record := anxcloudDns.Record{}
-
 	records := make([]*anxcloudDns.Record, 0)
 	for res := range channel {
+		record := anxcloudDns.Record{}
 		if err := res(&record); err != nil {
 			log.Errorf("failed to parse record: %v", err)
 			return nil, err
 		}
+		record.ZoneName = zoneName
 		records = append(records, &record)
 	}
 
@@ -115,20 +131,8 @@ func (c *DNSClient) GetZonesByDomainName(ctx context.Context, domainName string)
 	if err != nil {
 		return nil, err
 	}
-	possibleZones := make([]*anxcloudDns.Zone, 0)
-	for _, zone := range allZones {
-		if strings.HasSuffix(domainName, zone.Name) {
-			possibleZones = append(possibleZones, zone)
-		}
-	}
-
-	// sort zones by length, longest first
-	// this is necessary because the domain name might match multiple zones
-	// and we want to use the most specific one
-	sort.Slice(possibleZones, func(i, j int) bool {
-		return len(possibleZones[i].Name) > len(possibleZones[j].Name)
-	})
-	return possibleZones, nil
+	// the domain name might belong to multiple zones, the most specific one comes first
+	return newZoneTrie(allZones).match(domainName), nil
 }
 
 func (c *DNSClient) DeleteRecord(ctx context.Context, zoneName, recordID string) error {
@@ -161,10 +165,38 @@ func (c *DNSClient) CreateRecord(ctx context.Context, _ string, record *anxcloud
 	return nil
 }
 
+func (c *DNSClient) UpdateRecord(ctx context.Context, _ string, record *anxcloudDns.Record) error {
+	if c.dryRun {
+		log.Infof("dry run: would update record %v", record)
+		return nil
+	}
+	log.Debugf("update record %v ...", record)
+	err := c.client.Update(ctx, record)
+	if err != nil {
+		log.Errorf("failed to update record %v: %v", record, err)
+		return err
+	}
+	log.Debug("record updated")
+	return nil
+}
+
 type Provider struct {
 	provider.BaseProvider
 	client       DNSService
 	domainFilter endpoint.DomainFilter
+	drift        *driftDetector
+	state        state.Store
+	scope        *recordScope
+	ttlPolicy    *ttlPolicy
+	rewriting    *rewriter
+	zoneMapping  *zoneMapping
+	ptr          *ptrManager
+	flattening   *flattener
+	health       *healthChecker
+	current      recordCache
+
+	// mu serializes the changes of external-dns and of drift repairs
+	mu sync.Mutex
 }
 
 // NewProvider returns an instance of new provider
@@ -177,6 +209,59 @@ func NewProvider(configuration *Configuration, domainFilter endpoint.DomainFilte
 		client:       &DNSClient{client: client, dryRun: configuration.DryRun},
 		domainFilter: domainFilter,
 	}
+	if configuration.StateStore != "" {
+		prov.state, err = state.New(configuration.StateStore, configuration.StateStorePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create state store, STATE_STORE_PATH has to be set for STATE_STORE=bolt: %w", err)
+		}
+	}
+	prov.scope, err = newRecordScope(configuration.ManagedRecordTypes, configuration.ManageApexNSSOA)
+	if err != nil {
+		return nil, err
+	}
+	if configuration.TTLPolicyFile != "" {
+		prov.ttlPolicy, err = loadTTLPolicy(configuration.TTLPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.RewriteRulesFile != "" {
+		prov.rewriting, err = loadRewriteRules(configuration.RewriteRulesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.ZoneMappingFile != "" {
+		prov.zoneMapping, err = loadZoneMapping(configuration.ZoneMappingFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(configuration.PTRCIDRs) > 0 {
+		prov.ptr, err = newPTRManager(configuration.PTRCIDRs, configuration.PTRConflictPolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.CNAMEFlattening {
+		prov.flattening, err = newFlattener(configuration.CNAMEFlatteningResolver, configuration.CNAMEFlatteningInterval, prov.state)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.HealthCheckInterval > 0 {
+		prov.health, err = newHealthChecker(configuration.HealthCheckInterval, configuration.HealthCheckTimeout,
+			configuration.HealthCheckHealthyThreshold, configuration.HealthCheckUnhealthyThreshold)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if configuration.DriftDetectionInterval > 0 {
+		if prov.state == nil {
+			return nil, fmt.Errorf("drift detection keeps the last applied endpoints in the state store, STATE_STORE must be set")
+		}
+		prov.drift = newDriftDetector(prov.state, configuration.DriftDetectionInterval, configuration.DriftRepair)
+	}
 	return prov, nil
 }
 
@@ -206,128 +291,427 @@ func createClient(configuration *Configuration) (apiClient types.API, err error)
 	return apiClient, nil
 }
 
+// Validate checks that the configured credentials grant access to the Anexia DNS API,
+// it returns the names of the zones which are accessible
+func (p *Provider) Validate(ctx context.Context) ([]string, error) {
+	zones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneNames := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		zoneNames = append(zoneNames, zone.Name)
+	}
+	sort.Strings(zoneNames)
+	return zoneNames, nil
+}
+
 func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	records, err := p.client.GetRecords(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	groups := make(map[string][]*endpoint.Endpoint, 0)
+	recordsByZone := make(map[string][]*anxcloudDns.Record)
+	for _, record := range records {
+		recordsByZone[record.ZoneName] = append(recordsByZone[record.ZoneName], record)
+	}
+	zoneDelegations := make(map[string]delegations, len(recordsByZone))
+	for zoneName, zoneRecords := range recordsByZone {
+		zoneDelegations[zoneName] = findDelegations(zoneRecords)
+	}
+
+	endpoints := make([]*endpoint.Endpoint, 0, len(records))
 	for _, record := range records {
+		if !p.scope.manages(record.Type, isApexRecordName(record.Name)) {
+			continue
+		}
 		ep := recordToEndpoint(record)
-		if p.domainFilter.IsConfigured() && !p.domainFilter.Match(ep.DNSName) {
+		if !p.matchesDomainFilter(ep.DNSName) {
 			log.Debugf("Skipping record %s because it was filtered out by the domain filter", ep.DNSName)
 			continue
 		}
-		key := ep.DNSName + ep.RecordType
-		groups[key] = append(groups[key], ep)
-	}
-
-	mergedEndpoints := make([]*endpoint.Endpoint, 0)
-	for _, endpoints := range groups {
-		mergedEndpoint := &endpoint.Endpoint{
-			DNSName:    endpoints[0].DNSName,
-			RecordType: endpoints[0].RecordType,
-			RecordTTL:  endpoints[0].RecordTTL,
-		}
-		for _, ep := range endpoints {
-			mergedEndpoint.Targets = append(mergedEndpoint.Targets, ep.Targets...)
+		if point, hidden := zoneDelegations[record.ZoneName].hides(domainName(record.Name, record.ZoneName), record.Type); hidden {
+			log.Debugf("skipping %s record %s of zone %s, %s is delegated to other nameservers", record.Type, ep.DNSName, record.ZoneName, point)
+			continue
 		}
-		mergedEndpoints = append(mergedEndpoints, mergedEndpoint)
+		ep.RecordTTL = p.ttlPolicy.withDefault(ep.DNSName, ep.RecordType, ep.RecordTTL)
+		endpoints = append(endpoints, ep)
 	}
-	return mergedEndpoints, nil
+	merged := mergeEndpoints(endpoints)
+	if p.flattening != nil {
+		merged = p.flattening.report(merged)
+	}
+	if p.rewriting != nil {
+		merged = p.rewriting.reverseEndpoints(merged)
+	}
+	if p.health != nil {
+		p.health.report(merged)
+	}
+	p.current.update(records, merged)
+	return merged, nil
 }
 
+// recordToEndpoint returns the endpoint of a single record, its target is the canonical rdata the changes are compared
+// with, so records which differ from the desired targets only in form do not show up as changes
 func recordToEndpoint(record *anxcloudDns.Record) *endpoint.Endpoint {
+	dnsName := domainName(record.Name, record.ZoneName)
+	if unicodeName, err := toUnicodeName(dnsName); err == nil {
+		dnsName = unicodeName
+	} else {
+		log.Debugf("returning record %s of zone %s without IDNA conversion: %v", record.Name, record.ZoneName, err)
+		dnsName = normalizeDomainName(dnsName)
+	}
+	ep := &endpoint.Endpoint{
+		DNSName:    dnsName,
+		RecordTTL:  endpoint.TTL(record.TTL),
+		RecordType: record.Type,
+		Targets:    []string{canonicalTarget(record.Type, record.RData)},
+	}
+	setEndpointRegion(ep, record.Region)
+	setRecordMetadata(ep, record)
+	return ep
+}
 
-	return &endpoint.Endpoint{
-		DNSName: func() string {
-			if record.Name == "@" || record.Name == "" {
-				return record.ZoneName
+// AdjustEndpoints normalizes the names, TTLs, regions and targets of the desired endpoints the same way Records
+// returns them, so that internationalized names, unset TTLs, regions or targets which differ only in form, like case,
+// trailing dots or quoting, do not show up as changes.
+// The record metadata of the current endpoints is copied for the same reason. Endpoints with invalid names,
+// unsupported record types, invalid targets or names which the rewrite rules can not map back are rejected before
+// planning.
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		dnsName, err := toUnicodeName(ep.DNSName)
+		if err != nil {
+			log.Errorf("rejecting %s record: %v", ep.RecordType, err)
+			continue
+		}
+		if err := validateEndpoint(ep); err != nil {
+			log.Warnf("rejecting %s record %s: %v", ep.RecordType, ep.DNSName, err)
+			continue
+		}
+		// the zones are known by their ASCII names, a name which can not be converted is no apex
+		publishedASCIIName, _ := toASCIIName(p.publishedName(dnsName))
+		if !p.scope.manages(ep.RecordType, p.current.isZone(publishedASCIIName)) {
+			log.Debugf("rejecting %s record %s, the record type is not managed", ep.RecordType, ep.DNSName)
+			continue
+		}
+		if p.rewriting != nil {
+			if err := p.rewriting.checkRoundTrip(dnsName); err != nil {
+				log.Warnf("rejecting %s record %s: %v", ep.RecordType, ep.DNSName, err)
+				continue
 			}
-			return record.Name + "." + record.ZoneName
+		}
+		region, _ := endpointRegion(ep)
+		setEndpointRegion(ep, region)
+		ep.DNSName = dnsName
+		for i, target := range ep.Targets {
+			ep.Targets[i] = canonicalTarget(ep.RecordType, target)
+		}
+		p.current.copyRecordMetadata(ep)
+		if p.flattening != nil {
+			p.flattening.adjust(ep, p.publishedName(ep.DNSName), p.current.endpoint(endpointKey(ep)))
+		}
+		ep.RecordTTL = p.ttlPolicy.adjust(p.publishedName(ep.DNSName), ep.RecordType, ep.RecordTTL)
+		adjusted = append(adjusted, ep)
+	}
+	if p.health != nil {
+		p.health.register(adjusted)
+		for _, ep := range adjusted {
+			p.health.adjust(ep)
+		}
+	}
+	return adjusted, nil
+}
 
-		}(),
-		RecordTTL:  endpoint.TTL(record.TTL),
-		RecordType: record.Type,
-		Targets:    []string{record.RData},
+// matchesDomainFilter checks the name at Anexia against the domain filter, which might be configured in either IDNA
+// form. The domain filter is shared with external-dns, so names are checked after reversing the rewrite rules.
+func (p *Provider) matchesDomainFilter(dnsName string) bool {
+	if !p.domainFilter.IsConfigured() {
+		return true
 	}
+	if p.rewriting != nil {
+		reversed, ok := p.rewriting.reverse(dnsName)
+		if !ok {
+			return false
+		}
+		dnsName = reversed
+	}
+	if p.domainFilter.Match(dnsName) {
+		return true
+	}
+	if asciiName, err := toASCIIName(dnsName); err == nil && p.domainFilter.Match(asciiName) {
+		return true
+	}
+	if unicodeName, err := toUnicodeName(dnsName); err == nil && p.domainFilter.Match(unicodeName) {
+		return true
+	}
+	return false
 }
 
 func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.applyChanges(ctx, changes)
+}
+
+// applyChanges applies the changes, the caller has to hold the lock
+func (p *Provider) applyChanges(ctx context.Context, changes *plan.Changes) error {
 	epToCreate, epToDelete := GetCreateDeleteSetsFromChanges(changes)
 	log.Debugf("apply changes, create: %d, delete: %d", len(epToCreate), len(epToDelete))
+	if len(epToCreate) == 0 && len(epToDelete) == 0 {
+		return nil
+	}
+	desiredCreates := slices.Clone(epToCreate)
+	desiredDeletes := slices.Clone(epToDelete)
+
+	if p.health != nil {
+		for i, ep := range epToCreate {
+			epToCreate[i] = p.health.withhold(ep)
+		}
+	}
+	if p.rewriting != nil {
+		epToCreate = p.rewriting.rewriteEndpoints(epToCreate)
+		epToDelete = p.rewriting.rewriteEndpoints(epToDelete)
+	}
+	// origins maps the endpoints the records are built from to the endpoints of the changes, both steps above keep
+	// the order of the endpoints
+	origins := make(map[*endpoint.Endpoint]*endpoint.Endpoint, len(epToCreate))
+	for i, ep := range epToCreate {
+		origins[ep] = desiredCreates[i]
+	}
+
+	allZones, err := p.client.GetZones(ctx)
+	if err != nil {
+		log.Errorf("failed to get zones: %v", err)
+		return err
+	}
+	zones := newZoneTrie(allZones)
+	// the checks of the planned records share one fetch of each zone
+	snapshot := newZoneSnapshot(p.client)
+	epToCreate, epToDelete, err = p.flattenApexCNAMEs(ctx, zones, epToCreate, epToDelete, origins)
+	if err != nil {
+		return err
+	}
+
+	recordsToDelete := p.recordsToDelete(ctx, zones, epToDelete)
+	recordsToCreate, recordSources := p.recordsToCreate(zones, epToCreate)
+	builtRecords := recordsToCreate
+	recordsToDelete = p.withinScope(recordsToDelete, "deletion")
+	recordsToCreate = p.withinScope(recordsToCreate, "creation")
+	recordsToDelete, recordsToCreate, err = p.withoutDelegatedRecords(ctx, snapshot, recordsToDelete, recordsToCreate, recordSources)
+	if err != nil {
+		return err
+	}
+	recordsToDelete, recordsToCreate, err = p.withoutCNAMEConflicts(ctx, snapshot, recordsToDelete, recordsToCreate, recordSources)
+	if err != nil {
+		return err
+	}
+	accepted := acceptedEndpoints(builtRecords, recordsToCreate, recordSources, origins)
+	ptrDeletes, ptrCreates, err := p.ptrChanges(ctx, snapshot, zones, recordsToDelete, recordsToCreate, recordSources)
+	if err != nil {
+		return err
+	}
+	recordsToDelete = append(recordsToDelete, p.withinScope(ptrDeletes, "deletion")...)
+	recordsToCreate = append(recordsToCreate, p.withinScope(ptrCreates, "creation")...)
+	recordsToCreate, recordsToUpdate, err := p.withoutExistingRecords(ctx, snapshot, recordsToDelete, recordsToCreate, recordSources)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range recordsToDelete {
+		if err := p.client.DeleteRecord(ctx, record.ZoneName, record.Identifier); err != nil {
+			return err
+		}
+		p.forgetRecord(record)
+		p.current.forget(record.Identifier)
+	}
+
+	hash := planHash(changes)
+	for _, record := range recordsToCreate {
+		if err := p.client.CreateRecord(ctx, record.ZoneName, record); err != nil {
+			return fmt.Errorf("the Anexia API rejected the %s record '%s' in zone %s: %w", record.Type, record.Name, record.ZoneName, err)
+		}
+		p.rememberRecord(record, recordSources[record], hash)
+	}
+	for _, record := range recordsToUpdate {
+		if err := p.client.UpdateRecord(ctx, record.ZoneName, record); err != nil {
+			return fmt.Errorf("the Anexia API rejected the TTL update of the %s record '%s' in zone %s: %w", record.Type, record.Name, record.ZoneName, err)
+		}
+		p.rememberRecord(record, recordSources[record], hash)
+	}
+
+	if p.drift != nil {
+		if err := p.drift.recordChanges(desiredDeletes, accepted); err != nil {
+			log.Errorf("failed to record the desired state: %v", err)
+		}
+	}
+	return nil
+}
 
+// recordsToDelete looks up the records at Anexia which belong to the endpoints to delete. Endpoints returned by
+// Records carry the identifiers of their records, those are deleted directly without looking them up again.
+// Immutable records are never deleted.
+func (p *Provider) recordsToDelete(ctx context.Context, zones *zoneTrie, epToDelete []*endpoint.Endpoint) []*anxcloudDns.Record {
 	recordsToDelete := make([]*anxcloudDns.Record, 0)
 	for _, ep := range epToDelete {
-		if p.domainFilter.IsConfigured() && !p.domainFilter.Match(ep.DNSName) {
+		if !p.matchesDomainFilter(ep.DNSName) {
 			log.Debugf("Skipping record %s because it was filtered out by the domain filter", ep.DNSName)
 			continue
 		}
-		potentialZones, err := p.client.GetZonesByDomainName(ctx, ep.DNSName)
+		dnsName, err := toASCIIName(ep.DNSName)
 		if err != nil {
-			log.Errorf("failed to get zones for domain %s: %v", ep.DNSName, err)
-			break
+			log.Errorf("skipping deletion of %s record: %v", ep.RecordType, err)
+			continue
+		}
+		region, err := endpointRegion(ep)
+		if err != nil {
+			log.Errorf("skipping deletion of %s record %s: %v", ep.RecordType, ep.DNSName, err)
+			continue
 		}
-		for _, zone := range potentialZones {
-			recordName := strings.TrimSuffix(ep.DNSName, "."+zone.Name)
-			records, err := p.client.GetRecordsByZoneNameAndName(ctx, zone.Name, recordName)
+		if records, found := p.current.recordsByID(ep, region); found {
+			recordsToDelete = append(recordsToDelete, withoutImmutable(records)...)
+			continue
+		}
+		_, resolution := p.resolveZone(zones, dnsName)
+		for _, zoneName := range resolution.DeleteZones {
+			recordName := recordName(dnsName, zoneName)
+			records, err := p.client.GetRecordsByZoneNameAndName(ctx, zoneName, recordName)
 			if err != nil {
-				log.Errorf("failed to get records for zone %s and name %s: %v", zone.Name, recordName, err)
+				log.Errorf("failed to get records for zone %s and name %s: %v", zoneName, recordName, err)
 				break
 			}
 			for _, record := range records {
-				if record.Type != ep.RecordType {
+				if !strings.EqualFold(record.Type, ep.RecordType) || !regionsEqual(record.Region, region) {
 					continue
 				}
 				for _, target := range ep.Targets {
-					if record.RData == target {
-						recordsToDelete = append(recordsToDelete, record)
+					if rdataEqual(record.Type, record.RData, target) {
+						recordsToDelete = append(recordsToDelete, withoutImmutable([]*anxcloudDns.Record{record})...)
 						break
 					}
 				}
 			}
 		}
 	}
+	return recordsToDelete
+}
 
-	for _, record := range recordsToDelete {
-		if err := p.client.DeleteRecord(ctx, record.ZoneName, record.Identifier); err != nil {
-			return err
-		}
-	}
-
+// recordsToCreate builds the records for the endpoints to create, one record per target. It also returns the
+// endpoint each record was built from.
+func (p *Provider) recordsToCreate(zones *zoneTrie, epToCreate []*endpoint.Endpoint) ([]*anxcloudDns.Record, map[*anxcloudDns.Record]*endpoint.Endpoint) {
 	recordsToCreate := make([]*anxcloudDns.Record, 0)
+	recordSources := make(map[*anxcloudDns.Record]*endpoint.Endpoint)
 	for _, ep := range epToCreate {
-		if p.domainFilter.IsConfigured() && !p.domainFilter.Match(ep.DNSName) {
+		if !p.matchesDomainFilter(ep.DNSName) {
 			log.Debugf("Skipping record %s because it was filtered out by the domain filter", ep.DNSName)
 			continue
 		}
-		zone, err := p.client.GetZonesByDomainName(ctx, ep.DNSName)
+		dnsName, err := toASCIIName(ep.DNSName)
 		if err != nil {
-			log.Errorf("failed to get zones for domain %s: %v", ep.DNSName, err)
-			break
+			log.Errorf("skipping creation of %s record: %v", ep.RecordType, err)
+			continue
+		}
+		if err := validateEndpoint(ep); err != nil {
+			log.Errorf("skipping creation of %s record %s: %v", ep.RecordType, ep.DNSName, err)
+			continue
 		}
-		if len(zone) == 0 {
-			log.Warnf("no zone found for domain %s", ep.DNSName)
+		zone, resolution := p.resolveZone(zones, dnsName)
+		if zone == nil {
+			log.Warnf("skipping creation of %s record %s: %s", ep.RecordType, ep.DNSName, resolution.Reason)
 			continue
 		}
+		// validated above
+		region, _ := endpointRegion(ep)
 		for _, target := range ep.Targets {
-			recordsToCreate = append(recordsToCreate, &anxcloudDns.Record{
-				ZoneName: zone[0].Name,
-				Name:     strings.TrimSuffix(ep.DNSName, "."+zone[0].Name),
+			if ep.RecordType == endpoint.RecordTypeTXT {
+				target = encodeTXT(target)
+			}
+			record := &anxcloudDns.Record{
+				ZoneName: zone.Name,
+				Name:     recordName(dnsName, zone.Name),
 				RData:    target,
-				TTL:      int(ep.RecordTTL),
+				TTL:      int(p.ttlPolicy.adjust(dnsName, ep.RecordType, ep.RecordTTL)),
 				Type:     ep.RecordType,
-			})
+				Region:   region,
+			}
+			recordsToCreate = append(recordsToCreate, record)
+			recordSources[record] = ep
 		}
 	}
+	return recordsToCreate, recordSources
+}
 
-	for _, record := range recordsToCreate {
-		if err := p.client.CreateRecord(ctx, record.ZoneName, record); err != nil {
-			return err
+// withinScope removes the records whose type is not managed, like the SOA and apex NS records of the zones. SOA
+// records are reported if enabled, but never changed.
+func (p *Provider) withinScope(records []*anxcloudDns.Record, action string) []*anxcloudDns.Record {
+	managed := make([]*anxcloudDns.Record, 0, len(records))
+	for _, record := range records {
+		if strings.EqualFold(record.Type, "SOA") {
+			log.Warnf("skipping %s of SOA record %s in zone %s, SOA records can not be changed", action, record.Name, record.ZoneName)
+			continue
+		}
+		if !p.scope.manages(record.Type, isApexRecordName(record.Name)) {
+			log.Warnf("skipping %s of %s record %s in zone %s, the record type is not managed", action, record.Type, record.Name, record.ZoneName)
+			continue
 		}
+		managed = append(managed, record)
 	}
+	return managed
+}
 
-	return nil
+// NegotiationHeaders advertises the managed record types in the response to the negotiation with external-dns
+func (p *Provider) NegotiationHeaders() map[string]string {
+	return map[string]string{
+		"X-Managed-Record-Types": strings.Join(p.scope.recordTypes(), ","),
+		"X-Managed-Apex-NS-SOA":  strconv.FormatBool(p.scope != nil && p.scope.apexNSSOA),
+	}
+}
+
+// publishedName returns the name of an endpoint at Anexia
+func (p *Provider) publishedName(dnsName string) string {
+	if p.rewriting == nil {
+		return dnsName
+	}
+	return p.rewriting.rewrite(dnsName)
+}
+
+// withoutImmutable removes immutable records, which can not be deleted
+func withoutImmutable(records []*anxcloudDns.Record) []*anxcloudDns.Record {
+	mutable := make([]*anxcloudDns.Record, 0, len(records))
+	for _, record := range records {
+		if record.Immutable {
+			log.Warnf("skipping deletion of the immutable %s record %s in zone %s", record.Type, record.Name, record.ZoneName)
+			continue
+		}
+		mutable = append(mutable, record)
+	}
+	return mutable
+}
+
+// keepReplacedRecords removes the records from the records to delete which have the name, type and region of a
+// refused record. An update deletes the old records before it creates the new ones, so if the new records are
+// refused, the old ones are kept instead of leaving the name without records.
+func keepReplacedRecords(recordsToDelete, refused []*anxcloudDns.Record) []*anxcloudDns.Record {
+	if len(refused) == 0 {
+		return recordsToDelete
+	}
+	replaced := make(map[string]bool, len(refused))
+	for _, record := range refused {
+		replaced[replacementKey(record)] = true
+	}
+	kept := make([]*anxcloudDns.Record, 0, len(recordsToDelete))
+	for _, record := range recordsToDelete {
+		if replaced[replacementKey(record)] {
+			log.Warnf("keeping %s record %s in zone %s, its replacement was refused", record.Type, record.Name, record.ZoneName)
+			continue
+		}
+		kept = append(kept, record)
+	}
+	return kept
+}
 
+func replacementKey(record *anxcloudDns.Record) string {
+	return recordSetKey(record.ZoneName, record) + "|" + strings.ToUpper(record.Type)
 }
@@ -3,12 +3,15 @@ package anexia
 import (
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"context"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,6 +36,26 @@ func TestNewProvider(t *testing.T) {
 	require.Equal(t, false, p.domainFilter.Match("b.de."))
 }
 
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(2, func(i int) string {
+			if i == 0 {
+				return "de"
+			}
+			return "com"
+		}),
+	}
+	provider := &Provider{client: mockDNSClient}
+	zoneNames, err := provider.Validate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"com", "de"}, zoneNames)
+
+	mockDNSClient.returnError = fmt.Errorf("unauthorized")
+	_, err = provider.Validate(ctx)
+	require.EqualError(t, err, "unauthorized")
+}
+
 func TestRecords(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	ctx := context.Background()
@@ -100,6 +123,65 @@ func TestRecords(t *testing.T) {
 				return "c.de", "A", endpoint.TTL(300), []string{"3.3.3.3"}
 			}),
 		},
+		{
+			name: "apex and wildcard records",
+			givenRecords: createRecordSlice(2, func(i int) (string, string, string, int, string) {
+				if i == 0 {
+					return "@", "a.de", "A", 300, "1.1.1.1"
+				}
+				return "*.apps", "a.de", "A", 300, "2.2.2.2"
+			}),
+			expectedEndpoints: createEndpointSlice(2, func(i int) (string, string, endpoint.TTL, []string) {
+				if i == 0 {
+					return "a.de", "A", endpoint.TTL(300), []string{"1.1.1.1"}
+				}
+				return "*.apps.a.de", "A", endpoint.TTL(300), []string{"2.2.2.2"}
+			}),
+		},
+		{
+			name: "internationalized names are returned in unicode",
+			givenRecords: createRecordSlice(2, func(i int) (string, string, string, int, string) {
+				if i == 0 {
+					return "@", "xn--bcher-kva.de", "A", 300, "1.1.1.1"
+				}
+				return "WWW", "xn--bcher-kva.de", "A", 300, "2.2.2.2"
+			}),
+			givenDomainFilter: endpoint.NewDomainFilter([]string{"xn--bcher-kva.de"}),
+			expectedEndpoints: createEndpointSlice(2, func(i int) (string, string, endpoint.TTL, []string) {
+				if i == 0 {
+					return "bücher.de", "A", endpoint.TTL(300), []string{"1.1.1.1"}
+				}
+				return "www.bücher.de", "A", endpoint.TTL(300), []string{"2.2.2.2"}
+			}),
+		},
+		{
+			name: "records with mixed TTLs are returned without TTL",
+			givenRecords: createRecordSlice(2, func(i int) (string, string, string, int, string) {
+				return "www", "a.de", "A", (i + 1) * 300, fmt.Sprintf("%d.%d.%d.%d", i+1, i+1, i+1, i+1)
+			}),
+			expectedEndpoints: []*endpoint.Endpoint{
+				{
+					DNSName: "www.a.de", RecordType: "A", RecordTTL: 0, Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"},
+					ProviderSpecific: endpoint.ProviderSpecific{{Name: providerSpecificMixedTTLs, Value: "300,600"}},
+				},
+			},
+		},
+		{
+			name: "records of different regions are returned as separate endpoints",
+			givenRecords: []*anxcloudDns.Record{
+				{Identifier: "1", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1"},
+				{Identifier: "2", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "2.2.2.2", Region: "eu"},
+				{Identifier: "3", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "3.3.3.3", Region: "eu"},
+			},
+			expectedEndpoints: []*endpoint.Endpoint{
+				{DNSName: "www.a.de", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"1.1.1.1"}},
+				{
+					DNSName: "www.a.de", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"2.2.2.2", "3.3.3.3"},
+					SetIdentifier:    "eu",
+					ProviderSpecific: endpoint.ProviderSpecific{{Name: providerSpecificRegion, Value: "eu"}},
+				},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -116,11 +198,124 @@ func TestRecords(t *testing.T) {
 			}
 			require.NoError(t, err)
 			require.Len(t, endpoints, len(tc.expectedEndpoints))
-			assert.ElementsMatch(t, tc.expectedEndpoints, endpoints)
+			// the record metadata is covered by TestRecordsMetadata
+			assert.ElementsMatch(t, tc.expectedEndpoints, withoutRecordMetadata(endpoints))
 		})
 	}
 }
 
+func TestTargetsDifferingInFormAreNoChange(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allRecords: []*anxcloudDns.Record{
+			{Identifier: "1", ZoneName: "a.de", Name: "www", Type: "CNAME", TTL: 300, RData: "Target.DE."},
+			{Identifier: "2", ZoneName: "a.de", Name: "v6", Type: "AAAA", TTL: 300, RData: "2001:DB8:0::1"},
+			{Identifier: "3", ZoneName: "a.de", Name: "", Type: "MX", TTL: 300, RData: "10  Mail.a.de."},
+			{Identifier: "4", ZoneName: "a.de", Name: "txt", Type: "TXT", TTL: 300, RData: "\"hello \""},
+		},
+	}
+	provider := &Provider{client: mockDNSClient}
+	current, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	targets := make([]string, 0, len(current))
+	for _, ep := range current {
+		targets = append(targets, ep.Targets...)
+	}
+	assert.Equal(t, []string{"10 mail.a.de", "hello ", "2001:db8::1", "target.de"}, targets)
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.a.de", "CNAME", 300, "target.de."),
+		endpoint.NewEndpointWithTTL("v6.a.de", "AAAA", 300, "2001:db8::1"),
+		endpoint.NewEndpointWithTTL("a.de", "MX", 300, "10 mail.a.de"),
+		endpoint.NewEndpointWithTTL("txt.a.de", "TXT", 300, "hello "),
+	})
+	require.NoError(t, err)
+	changes := (&plan.Plan{Current: current, Desired: desired, ManagedRecords: []string{"CNAME", "AAAA", "MX", "TXT"}}).Calculate().Changes
+	assert.False(t, changes.HasChanges(), "targets which differ only in form are no change")
+}
+
+func TestMixedTTLsArePlannedAsUpdate(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allRecords: []*anxcloudDns.Record{
+			{Identifier: "1", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1"},
+			{Identifier: "2", ZoneName: "a.de", Name: "www", Type: "A", TTL: 600, RData: "2.2.2.2"},
+		},
+	}
+	provider := &Provider{client: mockDNSClient}
+	current, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	// the desired endpoint has no TTL, so the planner does not compare the TTLs
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpoint("www.a.de", "A", "1.1.1.1", "2.2.2.2")})
+	require.NoError(t, err)
+
+	changes := (&plan.Plan{Current: current, Desired: desired, ManagedRecords: []string{"A"}}).Calculate().Changes
+	require.Len(t, changes.UpdateNew, 1, "the records with mixed TTLs are rewritten")
+	toCreate, toDelete := GetCreateDeleteSetsFromChanges(changes)
+	assert.Len(t, toCreate, 1)
+	assert.Len(t, toDelete, 1)
+}
+
+func TestRecordsMetadata(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allRecords: []*anxcloudDns.Record{
+			{Identifier: "id-2", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "2.2.2.2"},
+			{Identifier: "id-1", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1"},
+			{Identifier: "id-ns", ZoneName: "a.de", Name: "@", Type: "NS", TTL: 3600, RData: "ns1.anexia.com", Immutable: true},
+		},
+	}
+	// the immutable apex NS record is only returned if apex NS records are managed
+	provider := &Provider{client: mockDNSClient, scope: &recordScope{apexNSSOA: true}}
+	endpoints, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	require.Len(t, endpoints, 2)
+
+	assert.Equal(t, endpoint.ProviderSpecific{
+		{Name: providerSpecificRecordIDs, Value: "id-ns"},
+		{Name: providerSpecificZone, Value: "a.de"},
+		{Name: providerSpecificImmutable, Value: "true"},
+	}, endpoints[0].ProviderSpecific)
+	assert.Equal(t, endpoint.Targets{"1.1.1.1", "2.2.2.2"}, endpoints[1].Targets)
+	assert.Equal(t, endpoint.ProviderSpecific{
+		{Name: providerSpecificRecordIDs, Value: "id-1,id-2"},
+		{Name: providerSpecificZone, Value: "a.de"},
+	}, endpoints[1].ProviderSpecific, "the identifiers are in the order of the targets")
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "1.1.1.1", "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("new.a.de", "A", 300, "1.1.1.1").WithProviderSpecific(providerSpecificRecordIDs, "forged"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, endpoints[1].ProviderSpecific, desired[0].ProviderSpecific, "the metadata of the current endpoint is copied")
+	assert.Empty(t, desired[1].ProviderSpecific, "endpoints without current endpoint have no metadata")
+}
+
+func TestApplyChangesDeletesByRecordID(t *testing.T) {
+	ctx := context.Background()
+	records := []*anxcloudDns.Record{
+		{Identifier: "id-1", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1"},
+		{Identifier: "id-2", ZoneName: "a.de", Name: "www", Type: "A", TTL: 300, RData: "2.2.2.2"},
+		{Identifier: "id-txt", ZoneName: "a.de", Name: "www", Type: "TXT", TTL: 300, RData: "\"heritage=external-dns\""},
+		{Identifier: "id-ns", ZoneName: "a.de", Name: "@", Type: "NS", TTL: 3600, RData: "ns1.anexia.com", Immutable: true},
+	}
+	mockDNSClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": records},
+	}
+	provider := &Provider{client: mockDNSClient, scope: &recordScope{apexNSSOA: true}}
+	current, err := provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, current, 3)
+
+	// the TXT registry copies the properties of an endpoint to its ownership record
+	ownership := endpoint.NewEndpointWithTTL("www.a.de", "TXT", 300, "heritage=external-dns")
+	ownership.ProviderSpecific = append(endpoint.ProviderSpecific{}, current[1].ProviderSpecific[0])
+	changes := &plan.Changes{Delete: []*endpoint.Endpoint{current[0], current[1], ownership}}
+	require.NoError(t, provider.ApplyChanges(ctx, changes))
+
+	assert.Equal(t, 1, mockDNSClient.lookups, "only the ownership record with foreign identifiers is looked up")
+	assert.ElementsMatch(t, []string{"id-1", "id-2", "id-txt"}, mockDNSClient.deletedRecords["a.de"], "immutable records are not deleted")
+}
+
 func TestApplyChanges(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	log.SetReportCaller(true)
@@ -165,6 +360,26 @@ func TestApplyChanges(t *testing.T) {
 			},
 			expectedRecordsDeleted: nil,
 		},
+		{
+			name: "create a record in a zone with a name which only ends with the zone name",
+			givenZones: createZoneSlice(2, func(i int) string {
+				if i == 0 {
+					return "example.de"
+				}
+				return deZoneName
+			}),
+			givenZoneRecords: map[string][]*anxcloudDns.Record{},
+			whenChanges: &plan.Changes{
+				Create: createEndpointSlice(1, func(_ int) (string, string, endpoint.TTL, []string) {
+					return "www.badexample.de", "A", endpoint.TTL(300), []string{"1.2.3.4"}
+				}),
+			},
+			expectedRecordsCreated: map[string][]*anxcloudDns.Record{
+				deZoneName: createRecordSlice(1, func(_ int) (string, string, string, int, string) {
+					return "www.badexample", deZoneName, "A", 300, "1.2.3.4"
+				}),
+			},
+		},
 		{
 			name: "create a record which is filtered out from the domain filter",
 			givenZones: createZoneSlice(1, func(_ int) string {
@@ -224,6 +439,124 @@ func TestApplyChanges(t *testing.T) {
 				deZoneName: {"0"},
 			},
 		},
+		{
+			name: "create and delete records at the apex and with wildcards",
+			givenZones: createZoneSlice(1, func(_ int) string {
+				return "example.de"
+			}),
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"example.de": createRecordSlice(2, func(i int) (string, string, string, int, string) {
+					if i == 0 {
+						return "@", "example.de", "A", 300, "1.2.3.4"
+					}
+					return "*.apps", "example.de", "A", 300, "1.2.3.4"
+				}),
+			},
+			whenChanges: &plan.Changes{
+				Create: createEndpointSlice(3, func(i int) (string, string, endpoint.TTL, []string) {
+					switch i {
+					case 0:
+						return "example.de", "A", endpoint.TTL(300), []string{"5.6.7.8"}
+					case 1:
+						return "Example.DE.", "TXT", endpoint.TTL(300), []string{"text"}
+					default:
+						return "*.apps.example.de", "A", endpoint.TTL(300), []string{"5.6.7.8"}
+					}
+				}),
+				Delete: createEndpointSlice(2, func(i int) (string, string, endpoint.TTL, []string) {
+					if i == 0 {
+						return "example.de", "A", endpoint.TTL(300), []string{"1.2.3.4"}
+					}
+					return "*.apps.example.de", "A", endpoint.TTL(300), []string{"1.2.3.4"}
+				}),
+			},
+			expectedRecordsCreated: map[string][]*anxcloudDns.Record{
+				"example.de": createRecordSlice(3, func(i int) (string, string, string, int, string) {
+					switch i {
+					case 0:
+						return "@", "example.de", "A", 300, "5.6.7.8"
+					case 1:
+						return "@", "example.de", "TXT", 300, "\"text\""
+					default:
+						return "*.apps", "example.de", "A", 300, "5.6.7.8"
+					}
+				}),
+			},
+			expectedRecordsDeleted: map[string][]string{
+				"example.de": {"0", "1"},
+			},
+		},
+		{
+			name: "create and delete records with internationalized names",
+			givenZones: createZoneSlice(1, func(_ int) string {
+				return "xn--bcher-kva.de"
+			}),
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"xn--bcher-kva.de": createRecordSlice(1, func(_ int) (string, string, string, int, string) {
+					return "xn--mnchen-3ya", "xn--bcher-kva.de", "A", 300, "1.2.3.4"
+				}),
+			},
+			givenDomainFilter: endpoint.NewDomainFilter([]string{"bücher.de"}),
+			whenChanges: &plan.Changes{
+				Create: createEndpointSlice(3, func(i int) (string, string, endpoint.TTL, []string) {
+					switch i {
+					case 0:
+						return "Straße.Bücher.de", "A", endpoint.TTL(300), []string{"5.6.7.8"}
+					case 1:
+						return "in valid.bücher.de", "A", endpoint.TTL(300), []string{"5.6.7.8"}
+					default:
+						return "www.xn--bcher-kva.de", "A", endpoint.TTL(300), []string{"5.6.7.8"}
+					}
+				}),
+				Delete: createEndpointSlice(1, func(_ int) (string, string, endpoint.TTL, []string) {
+					return "münchen.bücher.de", "A", endpoint.TTL(300), []string{"1.2.3.4"}
+				}),
+			},
+			expectedRecordsCreated: map[string][]*anxcloudDns.Record{
+				"xn--bcher-kva.de": createRecordSlice(2, func(i int) (string, string, string, int, string) {
+					if i == 0 {
+						return "xn--strae-oqa", "xn--bcher-kva.de", "A", 300, "5.6.7.8"
+					}
+					return "www", "xn--bcher-kva.de", "A", 300, "5.6.7.8"
+				}),
+			},
+			expectedRecordsDeleted: map[string][]string{
+				"xn--bcher-kva.de": {"0"},
+			},
+		},
+		{
+			name: "delete records with differently formatted targets",
+			givenZones: createZoneSlice(1, func(_ int) string {
+				return deZoneName
+			}),
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				deZoneName: createRecordSlice(3, func(i int) (string, string, string, int, string) {
+					switch i {
+					case 0:
+						return "a", deZoneName, "AAAA", 300, "2001:0db8:0000:0000:0000:0000:0000:0001"
+					case 1:
+						return "a", deZoneName, "TXT", 300, "\"heritage=external-dns\""
+					default:
+						return "b", deZoneName, "CNAME", 300, "Foo.Example.com."
+					}
+				}),
+			},
+			whenChanges: &plan.Changes{
+				Delete: createEndpointSlice(3, func(i int) (string, string, endpoint.TTL, []string) {
+					switch i {
+					case 0:
+						return "a.de", "AAAA", endpoint.TTL(300), []string{"2001:db8::1"}
+					case 1:
+						return "a.de", "TXT", endpoint.TTL(300), []string{"heritage=external-dns"}
+					default:
+						return "b.de", "CNAME", endpoint.TTL(300), []string{"foo.example.com"}
+					}
+				}),
+			},
+			expectedRecordsDeleted: map[string][]string{
+				deZoneName: {"0", "1", "2"},
+			},
+		},
 		{
 			name: "delete a record which is filtered out from the domain filter",
 			givenZones: createZoneSlice(1, func(_ int) string {
@@ -395,6 +728,16 @@ func TestApplyChanges(t *testing.T) {
 
 			require.NoError(t, err)
 			require.Len(t, mockDNSClient.createdRecords, len(tc.expectedRecordsCreated))
+			for zoneName, expectedRecords := range tc.expectedRecordsCreated {
+				require.Len(t, mockDNSClient.createdRecords[zoneName], len(expectedRecords), "created records in zone '%s' do not fit", zoneName)
+				for i, expectedRecord := range expectedRecords {
+					actualRecord := mockDNSClient.createdRecords[zoneName][i]
+					assert.Equal(t, expectedRecord.Name, actualRecord.Name)
+					assert.Equal(t, expectedRecord.Type, actualRecord.Type)
+					assert.Equal(t, expectedRecord.TTL, actualRecord.TTL)
+					assert.Equal(t, expectedRecord.RData, actualRecord.RData)
+				}
+			}
 
 			for zoneName, expectedDeletedRecordIDs := range tc.expectedRecordsDeleted {
 				require.Len(t, mockDNSClient.deletedRecords[zoneName], len(expectedDeletedRecordIDs), "deleted records in zone '%s' do not fit", zoneName)
@@ -406,22 +749,138 @@ func TestApplyChanges(t *testing.T) {
 	}
 }
 
+func TestApplyChangesState(t *testing.T) {
+	ctx := context.Background()
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"de": createRecordSlice(1, func(_ int) (string, string, string, int, string) {
+				return "old", "de", "A", 300, "1.1.1.1"
+			}),
+		},
+	}
+	store := state.NewMemoryStore()
+	require.NoError(t, store.Put(state.Entry{RecordID: "0", ZoneName: "de"}))
+	provider := &Provider{client: mockDNSClient, state: store}
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.de", "A", 300, "2.2.2.2", "3.3.3.3")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.de", "A", 300, "1.1.1.1")},
+	}
+	require.NoError(t, provider.ApplyChanges(ctx, changes))
+
+	entries, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "the deleted record is removed, the created ones are added")
+	for _, entry := range entries {
+		assert.Equal(t, "de", entry.ZoneName)
+		assert.Equal(t, "a", entry.Name)
+		assert.Equal(t, "a.de", entry.Endpoint.DNSName)
+		assert.Equal(t, planHash(changes), entry.PlanHash)
+		assert.False(t, entry.CreatedAt.IsZero())
+	}
+	assert.ElementsMatch(t, []string{"2.2.2.2", "3.3.3.3"}, []string{entries[0].RData, entries[1].RData})
+}
+
+func TestApplyChangesRegions(t *testing.T) {
+	ctx := context.Background()
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"de": {
+				{Identifier: "default", ZoneName: "de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1"},
+				{Identifier: "eu", ZoneName: "de", Name: "www", Type: "A", TTL: 300, RData: "1.1.1.1", Region: "eu"},
+			},
+		},
+	}
+	provider := &Provider{client: mockDNSClient}
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.de", "A", 300, "2.2.2.2").WithSetIdentifier("us"),
+			endpoint.NewEndpointWithTTL("www.de", "CNAME", 300, "us.example.com").
+				WithProviderSpecific(providerSpecificRegion, "ap"),
+		},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "1.1.1.1").WithSetIdentifier("eu")},
+	}
+	require.NoError(t, provider.ApplyChanges(ctx, changes))
+
+	assert.Equal(t, []string{"eu"}, mockDNSClient.deletedRecords["de"], "only the record of the region is deleted")
+	require.Len(t, mockDNSClient.createdRecords["de"], 2, "records of different regions do not conflict")
+	assert.Equal(t, "us", mockDNSClient.createdRecords["de"][0].Region)
+	assert.Equal(t, "ap", mockDNSClient.createdRecords["de"][1].Region)
+}
+
 func TestAdjustEndpoints(t *testing.T) {
 	provider := &Provider{}
-	endpoints := createEndpointSlice(rand.Intn(5), func(_ int) (string, string, endpoint.TTL, []string) {
-		return RandStringRunes(10), RandStringRunes(1), endpoint.TTL(300), []string{RandStringRunes(5)}
+	endpoints := createEndpointSlice(rand.Intn(5)+1, func(_ int) (string, string, endpoint.TTL, []string) {
+		return strings.ToLower(RandStringRunes(10)) + ".de", "TXT", endpoint.TTL(300), []string{RandStringRunes(5)}
+	})
+	// AdjustEndpoints changes the endpoints in place, normalized endpoints have to come back unchanged
+	expectedEndpoints := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		expectedEndpoints = append(expectedEndpoints, ep.DeepCopy())
+	}
+	actualEndpoints, err := provider.AdjustEndpoints(endpoints)
+	require.NoError(t, err)
+	require.Equal(t, expectedEndpoints, actualEndpoints)
+}
+
+func TestAdjustEndpointsNormalizesNames(t *testing.T) {
+	provider := &Provider{}
+	endpoints := createEndpointSlice(3, func(i int) (string, string, endpoint.TTL, []string) {
+		switch i {
+		case 0:
+			return "WWW.xn--bcher-kva.de.", "A", endpoint.TTL(300), []string{"1.1.1.1"}
+		case 1:
+			return "-invalid.bücher.de", "A", endpoint.TTL(300), []string{"1.1.1.1"}
+		default:
+			return "*.Bücher.de", "CNAME", endpoint.TTL(300), []string{"www.bücher.de"}
+		}
 	})
-	actualEndpoints, _ := provider.AdjustEndpoints(endpoints)
-	require.Equal(t, endpoints, actualEndpoints)
+	actualEndpoints, err := provider.AdjustEndpoints(endpoints)
+	require.NoError(t, err)
+	require.Len(t, actualEndpoints, 2)
+	assert.Equal(t, "www.bücher.de", actualEndpoints[0].DNSName)
+	assert.Equal(t, "*.bücher.de", actualEndpoints[1].DNSName)
+}
+
+func TestApplyChangesFetchesZonesOnce(t *testing.T) {
+	manager, err := newPTRManager([]string{"192.0.2.0/24"}, "")
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(2, func(i int) string { return []string{"de", "2.0.192.in-addr.arpa"}[i] }),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"de": {{Identifier: "1", ZoneName: "de", Name: "www", Type: "A", TTL: 300, RData: "192.0.2.10"}},
+		},
+	}
+	provider := &Provider{client: mockDNSClient, ptr: manager}
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("app.de", "A", 300, "192.0.2.11"),
+			endpoint.NewEndpointWithTTL("api.de", "TXT", 300, "owner"),
+		},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 600, "192.0.2.10")},
+	}))
+
+	assert.Equal(t, map[string]int{"de": 1, "2.0.192.in-addr.arpa": 1}, mockDNSClient.zoneFetches)
+	assert.Len(t, mockDNSClient.createdRecords["de"], 3)
+	assert.Len(t, mockDNSClient.createdRecords["2.0.192.in-addr.arpa"], 2)
 }
 
 type mockDNSClient struct {
 	returnError    error
+	createError    error // returned by CreateRecord only
 	allRecords     []*anxcloudDns.Record
 	zoneRecords    map[string][]*anxcloudDns.Record
 	allZones       []*anxcloudDns.Zone
 	createdRecords map[string][]*anxcloudDns.Record // zoneName -> recordCreates
 	deletedRecords map[string][]string              // zoneName -> recordIDs
+	updatedRecords map[string][]*anxcloudDns.Record // zoneName -> recordUpdates
+	lookups        int                              // calls of GetRecordsByZoneNameAndName
+	zoneFetches    map[string]int                   // zoneName -> calls of GetZoneRecords
 }
 
 func (c *mockDNSClient) GetRecords(_ context.Context) ([]*anxcloudDns.Record, error) {
@@ -431,11 +890,16 @@ func (c *mockDNSClient) GetRecords(_ context.Context) ([]*anxcloudDns.Record, er
 
 func (c *mockDNSClient) GetZoneRecords(_ context.Context, zoneName string) ([]*anxcloudDns.Record, error) {
 	log.Debugf("GetZoneRecords called with zoneName %s", zoneName)
+	if c.zoneFetches == nil {
+		c.zoneFetches = make(map[string]int)
+	}
+	c.zoneFetches[zoneName]++
 	return c.zoneRecords[zoneName], c.returnError
 }
 
 func (c *mockDNSClient) GetRecordsByZoneNameAndName(_ context.Context, zoneName, name string) ([]*anxcloudDns.Record, error) {
 	log.Debugf("GetRecordsByzoneNameAndName called with zoneName %s and name %s", zoneName, name)
+	c.lookups++
 	result := make([]*anxcloudDns.Record, 0)
 	recordsOfZone := c.zoneRecords[zoneName]
 	for _, record := range recordsOfZone {
@@ -460,13 +924,7 @@ func (c *mockDNSClient) GetZones(_ context.Context) ([]*anxcloudDns.Zone, error)
 
 func (c *mockDNSClient) GetZonesByDomainName(_ context.Context, domainName string) ([]*anxcloudDns.Zone, error) {
 	log.Debugf("GetZonesByDomainName called with domainName %s", domainName)
-	result := make([]*anxcloudDns.Zone, 0)
-	for _, zone := range c.allZones {
-		if strings.HasSuffix(domainName, zone.Name) {
-			result = append(result, zone)
-		}
-	}
-	return result, c.returnError
+	return newZoneTrie(c.allZones).match(domainName), c.returnError
 }
 
 func (c *mockDNSClient) CreateRecord(_ context.Context, zoneName string, record *anxcloudDns.Record) error {
@@ -474,10 +932,26 @@ func (c *mockDNSClient) CreateRecord(_ context.Context, zoneName string, record
 	if c.createdRecords == nil {
 		c.createdRecords = make(map[string][]*anxcloudDns.Record)
 	}
+	if c.createError != nil {
+		return c.createError
+	}
+	if c.returnError == nil {
+		// the Anexia API returns the identifier of the created record
+		record.Identifier = fmt.Sprintf("created-%s-%d", zoneName, len(c.createdRecords[zoneName]))
+	}
 	c.createdRecords[zoneName] = append(c.createdRecords[zoneName], record)
 	return c.returnError
 }
 
+func (c *mockDNSClient) UpdateRecord(_ context.Context, zoneName string, record *anxcloudDns.Record) error {
+	log.Debugf("UpdateRecord called with zoneName %s and record %v", zoneName, record)
+	if c.updatedRecords == nil {
+		c.updatedRecords = make(map[string][]*anxcloudDns.Record)
+	}
+	c.updatedRecords[zoneName] = append(c.updatedRecords[zoneName], record)
+	return c.returnError
+}
+
 func (c *mockDNSClient) DeleteRecord(_ context.Context, zoneName string, recordID string) error {
 	log.Debugf("DeleteRecord called with zoneName %s and recordID %s", zoneName, recordID)
 	if c.deletedRecords == nil {
@@ -487,6 +961,19 @@ func (c *mockDNSClient) DeleteRecord(_ context.Context, zoneName string, recordI
 	return c.returnError
 }
 
+// withoutRecordMetadata removes the record metadata from the endpoints returned by Records
+func withoutRecordMetadata(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	for _, ep := range endpoints {
+		for _, name := range recordMetadataProperties {
+			ep.DeleteProviderSpecificProperty(name)
+		}
+		if len(ep.ProviderSpecific) == 0 {
+			ep.ProviderSpecific = nil
+		}
+	}
+	return endpoints
+}
+
 func RandStringRunes(n int) string {
 	b := make([]rune, n)
 	for i := range b {
@@ -535,3 +1022,10 @@ func createZoneSlice(count int, modifier func(int) string) []*anxcloudDns.Zone {
 	}
 	return zones
 }
+
+// writeTestFile writes a configuration file with the given name to a temporary directory and returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
@@ -0,0 +1,230 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// policies for PTR records of an IP address which already points at another name
+const (
+	ptrConflictSkip      = "skip"
+	ptrConflictOverwrite = "overwrite"
+)
+
+// ptrManager derives PTR records in the reverse zones from the A and AAAA records which are created and deleted
+type ptrManager struct {
+	cidrs     []*net.IPNet
+	overwrite bool
+}
+
+func newPTRManager(cidrs []string, conflictPolicy string) (*ptrManager, error) {
+	manager := &ptrManager{}
+	switch conflictPolicy {
+	case "", ptrConflictSkip:
+	case ptrConflictOverwrite:
+		manager.overwrite = true
+	default:
+		return nil, fmt.Errorf("unknown PTR conflict policy '%s', expected one of: %s, %s", conflictPolicy, ptrConflictSkip, ptrConflictOverwrite)
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PTR CIDR: %w", err)
+		}
+		manager.cidrs = append(manager.cidrs, network)
+	}
+	return manager, nil
+}
+
+// manages reports whether PTR records are maintained for the IP address
+func (m *ptrManager) manages(ip net.IP) bool {
+	for _, network := range m.cidrs {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ptrChange is the PTR record of an address record which is created or deleted
+type ptrChange struct {
+	reverseName string
+	target      string
+	ttl         int
+	source      *anxcloudDns.Record
+}
+
+// ptrChanges returns the PTR records to delete and to create for the address records to delete and to create.
+// Only addresses in the configured CIDRs whose reverse zone exists are considered. A PTR record is deleted if it
+// points at the name of a deleted address record, an address which already points at another name is a conflict,
+// which is skipped or overwritten depending on the conflict policy. The PTR records to create are added to the
+// record sources with the endpoint of their address record.
+func (p *Provider) ptrChanges(ctx context.Context, snapshot *zoneSnapshot, zones *zoneTrie, recordsToDelete, recordsToCreate []*anxcloudDns.Record,
+	recordSources map[*anxcloudDns.Record]*endpoint.Endpoint) ([]*anxcloudDns.Record, []*anxcloudDns.Record, error) {
+	if p.ptr == nil {
+		return nil, nil, nil
+	}
+	deletes := p.ptr.changesFor(zones, recordsToDelete)
+	creates := p.ptr.changesFor(zones, recordsToCreate)
+
+	// addresses which are deleted and created again for the same name, like on TTL updates, keep their PTR record
+	created := make(map[string]bool, len(creates))
+	for _, change := range creates {
+		created[change.key()] = true
+	}
+
+	ptrRecordsAt := func(zone *anxcloudDns.Zone, reverseName string) ([]*anxcloudDns.Record, error) {
+		zoneRecords, err := snapshot.zoneRecords(ctx, zone.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get records of reverse zone %s: %w", zone.Name, err)
+		}
+		name := recordName(reverseName, zone.Name)
+		records := make([]*anxcloudDns.Record, 0)
+		for _, record := range zoneRecords {
+			if strings.EqualFold(record.Type, endpoint.RecordTypePTR) && strings.EqualFold(record.Name, name) {
+				records = append(records, record)
+			}
+		}
+		return records, nil
+	}
+
+	ptrDeletes := make([]*anxcloudDns.Record, 0)
+	deleted := make(map[string]bool)
+	for _, change := range deletes {
+		if created[change.key()] {
+			continue
+		}
+		zone := zones.longestMatch(change.reverseName)
+		records, err := ptrRecordsAt(zone, change.reverseName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, record := range records {
+			if deleted[record.Identifier] || !rdataEqual(endpoint.RecordTypePTR, record.RData, change.target) {
+				continue
+			}
+			log.Infof("deleting PTR record %s -> %s in zone %s", change.reverseName, change.target, zone.Name)
+			ptrChangesCounter.WithLabelValues("delete").Inc()
+			ptrDeletes = append(ptrDeletes, withoutImmutable([]*anxcloudDns.Record{record})...)
+			deleted[record.Identifier] = true
+		}
+	}
+
+	ptrCreates := make([]*anxcloudDns.Record, 0)
+	planned := make(map[string]string)
+	for _, change := range creates {
+		if target, found := planned[change.reverseName]; found {
+			if target != change.target {
+				log.Warnf("skipping PTR record %s -> %s, it is already planned to point at %s", change.reverseName, change.target, target)
+				ptrChangesCounter.WithLabelValues("conflict").Inc()
+			}
+			continue
+		}
+		zone := zones.longestMatch(change.reverseName)
+		records, err := ptrRecordsAt(zone, change.reverseName)
+		if err != nil {
+			return nil, nil, err
+		}
+		exists := false
+		conflicting := make([]*anxcloudDns.Record, 0)
+		for _, record := range records {
+			switch {
+			case deleted[record.Identifier]:
+			case rdataEqual(endpoint.RecordTypePTR, record.RData, change.target):
+				exists = true
+			default:
+				conflicting = append(conflicting, record)
+			}
+		}
+		if exists && len(conflicting) == 0 {
+			planned[change.reverseName] = change.target
+			continue
+		}
+		if len(conflicting) > 0 {
+			ptrChangesCounter.WithLabelValues("conflict").Inc()
+			if !p.ptr.overwrite {
+				log.Warnf("skipping PTR record %s -> %s, the address already points at %s", change.reverseName, change.target, ptrTargets(conflicting))
+				continue
+			}
+			log.Warnf("overwriting PTR record %s, it points at %s instead of %s", change.reverseName, ptrTargets(conflicting), change.target)
+			for _, record := range conflicting {
+				deleted[record.Identifier] = true
+			}
+			ptrDeletes = append(ptrDeletes, withoutImmutable(conflicting)...)
+		}
+		planned[change.reverseName] = change.target
+		if exists {
+			continue
+		}
+		log.Infof("creating PTR record %s -> %s in zone %s", change.reverseName, change.target, zone.Name)
+		ptrChangesCounter.WithLabelValues("create").Inc()
+		record := &anxcloudDns.Record{
+			ZoneName: zone.Name,
+			Name:     recordName(change.reverseName, zone.Name),
+			RData:    change.target,
+			TTL:      change.ttl,
+			Type:     endpoint.RecordTypePTR,
+		}
+		ptrCreates = append(ptrCreates, record)
+		recordSources[record] = recordSources[change.source]
+	}
+	return ptrDeletes, ptrCreates, nil
+}
+
+// changesFor returns the PTR records belonging to the managed address records, sorted by reverse name and target
+func (m *ptrManager) changesFor(zones *zoneTrie, records []*anxcloudDns.Record) []ptrChange {
+	changes := make([]ptrChange, 0)
+	for _, record := range records {
+		if !strings.EqualFold(record.Type, endpoint.RecordTypeA) && !strings.EqualFold(record.Type, endpoint.RecordTypeAAAA) {
+			continue
+		}
+		ip := net.ParseIP(strings.TrimSpace(record.RData))
+		if ip == nil || !m.manages(ip) {
+			continue
+		}
+		reverseName, err := dns.ReverseAddr(ip.String())
+		if err != nil {
+			continue
+		}
+		reverseName = normalizeDomainName(reverseName)
+		if zone := zones.longestMatch(reverseName); zone == nil || !isReverseZone(zone.Name) {
+			log.Debugf("not managing the PTR record of %s, there is no reverse zone for %s", ip, reverseName)
+			continue
+		}
+		changes = append(changes, ptrChange{
+			reverseName: reverseName,
+			target:      normalizeDomainName(domainName(record.Name, record.ZoneName)),
+			ttl:         record.TTL,
+			source:      record,
+		})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].key() < changes[j].key()
+	})
+	return changes
+}
+
+func (c ptrChange) key() string {
+	return c.reverseName + "|" + c.target
+}
+
+func isReverseZone(zoneName string) bool {
+	zoneName = normalizeDomainName(zoneName)
+	return strings.HasSuffix(zoneName, "in-addr.arpa") || strings.HasSuffix(zoneName, "ip6.arpa")
+}
+
+func ptrTargets(records []*anxcloudDns.Record) string {
+	targets := make(map[string]bool, len(records))
+	for _, record := range records {
+		targets[canonicalDomainName(record.RData)] = true
+	}
+	return joinSorted(targets)
+}
@@ -0,0 +1,219 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestNewPTRManager(t *testing.T) {
+	testCases := []struct {
+		name              string
+		givenCIDRs        []string
+		givenPolicy       string
+		expectedOverwrite bool
+		expectedError     string
+	}{
+		{name: "default policy", givenCIDRs: []string{"192.0.2.0/24", " 2001:db8::/32"}},
+		{name: "overwrite policy", givenCIDRs: []string{"192.0.2.0/24"}, givenPolicy: "overwrite", expectedOverwrite: true},
+		{name: "invalid CIDR", givenCIDRs: []string{"192.0.2.0"}, expectedError: "invalid PTR CIDR: invalid CIDR address: 192.0.2.0"},
+		{
+			name:          "unknown policy",
+			givenCIDRs:    []string{"192.0.2.0/24"},
+			givenPolicy:   "replace",
+			expectedError: "unknown PTR conflict policy 'replace', expected one of: skip, overwrite",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager, err := newPTRManager(tc.givenCIDRs, tc.givenPolicy)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, manager.cidrs, len(tc.givenCIDRs))
+			assert.Equal(t, tc.expectedOverwrite, manager.overwrite)
+		})
+	}
+}
+
+func TestApplyChangesPTR(t *testing.T) {
+	ctx := context.Background()
+	zones := createZoneSlice(3, func(i int) string {
+		return []string{"de", "2.0.192.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa"}[i]
+	})
+	testCases := []struct {
+		name             string
+		givenPolicy      string
+		givenZoneRecords map[string][]*anxcloudDns.Record
+		whenChanges      *plan.Changes
+		expectedCreated  map[string][]string // zone -> name and rdata of the PTR records
+		expectedDeleted  map[string][]string // zone -> record IDs
+	}{
+		{
+			name: "A record creates a PTR record",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+			},
+			expectedCreated: map[string][]string{"2.0.192.in-addr.arpa": {"10 www.de"}},
+		},
+		{
+			name: "AAAA record creates a PTR record",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "AAAA", 300, "2001:db8::1")},
+			},
+			expectedCreated: map[string][]string{
+				"8.b.d.0.1.0.0.2.ip6.arpa": {"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0 www.de"},
+			},
+		},
+		{
+			name: "addresses outside of the CIDRs are ignored",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "198.51.100.10")},
+			},
+		},
+		{
+			name: "addresses without reverse zone are ignored",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.3.10")},
+			},
+		},
+		{
+			name: "existing PTR record is kept",
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "www.de."}},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+			},
+		},
+		{
+			name: "deleted A record deletes its PTR record",
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"de": {{Identifier: "a", ZoneName: "de", Name: "www", Type: "A", RData: "192.0.2.10"}},
+				"2.0.192.in-addr.arpa": {
+					{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "www.de."},
+					{Identifier: "other", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "mail.de."},
+				},
+			},
+			whenChanges: &plan.Changes{
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+			},
+			expectedDeleted: map[string][]string{"de": {"a"}, "2.0.192.in-addr.arpa": {"ptr"}},
+		},
+		{
+			name: "updated TTL keeps the PTR record",
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"de":                   {{Identifier: "a", ZoneName: "de", Name: "www", Type: "A", RData: "192.0.2.10"}},
+				"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "www.de."}},
+			},
+			whenChanges: &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 600, "192.0.2.10")},
+			},
+			expectedDeleted: map[string][]string{"de": {"a"}},
+		},
+		{
+			name: "address moved to another name",
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"de":                   {{Identifier: "a", ZoneName: "de", Name: "old", Type: "A", RData: "192.0.2.10"}},
+				"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "old.de."}},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.de", "A", 300, "192.0.2.10")},
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.de", "A", 300, "192.0.2.10")},
+			},
+			expectedCreated: map[string][]string{"2.0.192.in-addr.arpa": {"10 new.de"}},
+			expectedDeleted: map[string][]string{"de": {"a"}, "2.0.192.in-addr.arpa": {"ptr"}},
+		},
+		{
+			name: "conflicting PTR record is skipped",
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "mail.de."}},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+			},
+		},
+		{
+			name:        "conflicting PTR record is overwritten",
+			givenPolicy: ptrConflictOverwrite,
+			givenZoneRecords: map[string][]*anxcloudDns.Record{
+				"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "10", Type: "PTR", RData: "mail.de."}},
+			},
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+			},
+			expectedCreated: map[string][]string{"2.0.192.in-addr.arpa": {"10 www.de"}},
+			expectedDeleted: map[string][]string{"2.0.192.in-addr.arpa": {"ptr"}},
+		},
+		{
+			name: "one address for multiple names only gets one PTR record",
+			whenChanges: &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10"),
+					endpoint.NewEndpointWithTTL("app.de", "A", 300, "192.0.2.10"),
+				},
+			},
+			expectedCreated: map[string][]string{"2.0.192.in-addr.arpa": {"10 app.de"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager, err := newPTRManager([]string{"192.0.2.0/24", "2001:db8::/32"}, tc.givenPolicy)
+			require.NoError(t, err)
+			mockDNSClient := &mockDNSClient{allZones: zones, zoneRecords: tc.givenZoneRecords}
+			provider := &Provider{client: mockDNSClient, ptr: manager}
+			require.NoError(t, provider.ApplyChanges(ctx, tc.whenChanges))
+
+			created := make(map[string][]string)
+			for zoneName, records := range mockDNSClient.createdRecords {
+				for _, record := range records {
+					if record.Type == endpoint.RecordTypePTR {
+						created[zoneName] = append(created[zoneName], record.Name+" "+record.RData)
+					}
+				}
+			}
+			assert.Equal(t, len(tc.expectedCreated), len(created))
+			for zoneName, expected := range tc.expectedCreated {
+				assert.Equal(t, expected, created[zoneName])
+			}
+			assert.Equal(t, len(tc.expectedDeleted), len(mockDNSClient.deletedRecords))
+			for zoneName, expected := range tc.expectedDeleted {
+				assert.ElementsMatch(t, expected, mockDNSClient.deletedRecords[zoneName])
+			}
+		})
+	}
+}
+
+func TestApplyChangesPTRNotManaged(t *testing.T) {
+	manager, err := newPTRManager([]string{"192.0.2.0/24"}, "")
+	require.NoError(t, err)
+	scope, err := newRecordScope([]string{"A"}, false)
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(2, func(i int) string { return []string{"de", "2.0.192.in-addr.arpa"}[i] }),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"de":                   {{Identifier: "old", ZoneName: "de", Name: "old", Type: "A", RData: "192.0.2.20"}},
+			"2.0.192.in-addr.arpa": {{Identifier: "ptr", ZoneName: "2.0.192.in-addr.arpa", Name: "20", Type: "PTR", RData: "old.de."}},
+		},
+	}
+	provider := &Provider{client: mockDNSClient, ptr: manager, scope: scope}
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.de", "A", 300, "192.0.2.10")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.de", "A", 300, "192.0.2.20")},
+	}))
+
+	assert.Len(t, mockDNSClient.createdRecords["de"], 1)
+	assert.Empty(t, mockDNSClient.createdRecords["2.0.192.in-addr.arpa"], "PTR records are not created if PTR is not a managed type")
+	assert.Equal(t, map[string][]string{"de": {"old"}}, mockDNSClient.deletedRecords)
+}
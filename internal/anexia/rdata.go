@@ -0,0 +1,173 @@
+package anexia
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// canonicalRData returns a canonical representation of the rdata of a record, so that semantically equal values
+// compare equal: IP addresses are formatted in their shortest form, domain names are lower case A-labels without
+// trailing dot, TXT values are compared without quoting and digests in lower case hex. Unparsable values are only
+// stripped of extra whitespace.
+func canonicalRData(recordType, rdata string) string {
+	rdata = strings.TrimSpace(rdata)
+	if strictRecordTypes[strings.ToUpper(recordType)] {
+		if canonical, ok := canonicalStrictRData(strings.ToUpper(recordType), rdata); ok {
+			return canonical
+		}
+	}
+	switch strings.ToUpper(recordType) {
+	case endpoint.RecordTypeA:
+		if ip := net.ParseIP(rdata); ip != nil && ip.To4() != nil {
+			return ip.To4().String()
+		}
+	case endpoint.RecordTypeAAAA:
+		if ip := net.ParseIP(rdata); ip != nil {
+			return ip.String()
+		}
+	case endpoint.RecordTypeCNAME, endpoint.RecordTypeNS, endpoint.RecordTypePTR, "DNAME":
+		return canonicalDomainName(rdata)
+	case endpoint.RecordTypeTXT, "SPF":
+		return decodeTXT(rdata)
+	case endpoint.RecordTypeMX:
+		fields := strings.Fields(rdata)
+		if len(fields) == 2 {
+			if preference, err := strconv.ParseUint(fields[0], 10, 16); err == nil {
+				return fmt.Sprintf("%d %s", preference, canonicalDomainName(fields[1]))
+			}
+		}
+	case endpoint.RecordTypeSRV:
+		fields := strings.Fields(rdata)
+		if len(fields) == 4 {
+			numbers := make([]uint64, 3)
+			for i := range numbers {
+				number, err := strconv.ParseUint(fields[i], 10, 16)
+				if err != nil {
+					return strings.Join(fields, " ")
+				}
+				numbers[i] = number
+			}
+			return fmt.Sprintf("%d %d %d %s", numbers[0], numbers[1], numbers[2], canonicalDomainName(fields[3]))
+		}
+	case "CAA":
+		flags, rest, _ := strings.Cut(rdata, " ")
+		tag, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if flag, err := strconv.ParseUint(flags, 10, 8); err == nil && tag != "" {
+			if unquoted, ok := unquoteTXT(strings.TrimSpace(value)); ok {
+				value = unquoted
+			}
+			return fmt.Sprintf("%d %s %s", flag, strings.ToLower(tag), quoteTXT(strings.TrimSpace(value)))
+		}
+	}
+	return strings.Join(strings.Fields(rdata), " ")
+}
+
+// canonicalTarget returns the canonical rdata of an endpoint target. TXT values are only unquoted, as their
+// whitespace is part of the value.
+func canonicalTarget(recordType, target string) string {
+	if strings.EqualFold(recordType, endpoint.RecordTypeTXT) {
+		return decodeTXT(target)
+	}
+	return canonicalRData(recordType, target)
+}
+
+// canonicalDomainName returns the lower case A-label form of a domain name in rdata, without trailing dot
+func canonicalDomainName(name string) string {
+	if asciiName, err := toASCIIName(name); err == nil {
+		return asciiName
+	}
+	return normalizeDomainName(name)
+}
+
+// rdataEqual reports whether two rdata values of the record type are semantically equal
+func rdataEqual(recordType, a, b string) bool {
+	return canonicalRData(recordType, a) == canonicalRData(recordType, b)
+}
+
+// targetsEqual reports whether two sets of targets of the record type are semantically equal, regardless of order
+func targetsEqual(recordType string, a, b endpoint.Targets) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	canonicalA := canonicalTargets(recordType, a)
+	canonicalB := canonicalTargets(recordType, b)
+	for i := range canonicalA {
+		if canonicalA[i] != canonicalB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func canonicalTargets(recordType string, targets endpoint.Targets) []string {
+	canonical := make([]string, len(targets))
+	for i, target := range targets {
+		canonical[i] = canonicalRData(recordType, target)
+	}
+	sort.Strings(canonical)
+	return canonical
+}
+
+// unquoteTXT parses a sequence of quoted character strings as used in zone files, like `"abc" "def"`, and returns
+// their concatenated content. It reports false if the value is not completely made up of quoted strings.
+func unquoteTXT(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "\"") {
+		return "", false
+	}
+	var content strings.Builder
+	for i := 0; i < len(value); {
+		switch {
+		case value[i] == ' ' || value[i] == '\t':
+			i++
+			continue
+		case value[i] != '"':
+			return "", false
+		}
+		// read one quoted character string
+		i++
+		for {
+			if i >= len(value) {
+				return "", false
+			}
+			c := value[i]
+			if c == '"' {
+				i++
+				break
+			}
+			if c != '\\' {
+				content.WriteByte(c)
+				i++
+				continue
+			}
+			if i+1 >= len(value) {
+				return "", false
+			}
+			// a backslash either escapes the next character or starts a decimal \DDD escape
+			if i+3 < len(value) && isDigit(value[i+1]) && isDigit(value[i+2]) && isDigit(value[i+3]) {
+				code, _ := strconv.Atoi(value[i+1 : i+4])
+				if code > 255 {
+					return "", false
+				}
+				content.WriteByte(byte(code))
+				i += 4
+				continue
+			}
+			content.WriteByte(value[i+1])
+			i += 2
+		}
+		if i < len(value) && value[i] != ' ' && value[i] != '\t' {
+			return "", false
+		}
+	}
+	return content.String(), true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,109 @@
+package anexia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestCanonicalRData(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenType     string
+		givenRData    string
+		expectedRData string
+	}{
+		{name: "A", givenType: "A", givenRData: " 1.2.3.4 ", expectedRData: "1.2.3.4"},
+		{name: "A in IPv4 mapped form", givenType: "A", givenRData: "::ffff:1.2.3.4", expectedRData: "1.2.3.4"},
+		{name: "invalid A", givenType: "A", givenRData: "1.2.3", expectedRData: "1.2.3"},
+		{name: "AAAA expanded", givenType: "AAAA", givenRData: "2001:0db8:0000:0000:0000:0000:0000:0001", expectedRData: "2001:db8::1"},
+		{name: "AAAA upper case", givenType: "aaaa", givenRData: "2001:DB8::1", expectedRData: "2001:db8::1"},
+		{name: "CNAME with trailing dot and upper case", givenType: "CNAME", givenRData: "Foo.Example.com.", expectedRData: "foo.example.com"},
+		{name: "CNAME with unicode labels", givenType: "CNAME", givenRData: "www.bücher.de", expectedRData: "www.xn--bcher-kva.de"},
+		{name: "NS", givenType: "NS", givenRData: "NS1.example.com.", expectedRData: "ns1.example.com"},
+		{name: "PTR", givenType: "PTR", givenRData: "host.example.com.", expectedRData: "host.example.com"},
+		{name: "TXT quoted", givenType: "TXT", givenRData: "\"v=spf1 -all\"", expectedRData: "v=spf1 -all"},
+		{name: "TXT unquoted", givenType: "TXT", givenRData: "v=spf1 -all", expectedRData: "v=spf1 -all"},
+		{name: "TXT multiple strings", givenType: "TXT", givenRData: "\"abc\" \"def\"", expectedRData: "abcdef"},
+		{name: "TXT escapes", givenType: "TXT", givenRData: "\"say \\\"hi\\\" \\\\ \\065\"", expectedRData: "say \"hi\" \\ A"},
+		{name: "TXT partially quoted", givenType: "TXT", givenRData: "\"abc\" def", expectedRData: "\"abc\" def"},
+		{name: "TXT unterminated quote", givenType: "TXT", givenRData: "\"abc", expectedRData: "\"abc"},
+		{name: "MX", givenType: "MX", givenRData: "010  Mail.example.com.", expectedRData: "10 mail.example.com"},
+		{name: "SRV", givenType: "SRV", givenRData: "10 05 5060 SIP.example.com.", expectedRData: "10 5 5060 sip.example.com"},
+		{name: "invalid SRV", givenType: "SRV", givenRData: "10 x 5060  sip.example.com", expectedRData: "10 x 5060 sip.example.com"},
+		{name: "CAA", givenType: "CAA", givenRData: "0 ISSUE letsencrypt.org", expectedRData: "0 issue \"letsencrypt.org\""},
+		{name: "CAA quoted", givenType: "CAA", givenRData: "0 issue \"letsencrypt.org\"", expectedRData: "0 issue \"letsencrypt.org\""},
+		{name: "unknown type", givenType: "HINFO", givenRData: " \"x86\"   \"Linux\" ", expectedRData: "\"x86\" \"Linux\""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRData, canonicalRData(tc.givenType, tc.givenRData))
+		})
+	}
+}
+
+func TestEndpointsAreDifferent(t *testing.T) {
+	testCases := []struct {
+		name              string
+		givenOld          *endpoint.Endpoint
+		givenNew          *endpoint.Endpoint
+		expectedDifferent bool
+	}{
+		{
+			name:              "same targets in different order",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1", "2.2.2.2"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "2.2.2.2", "1.1.1.1"),
+			expectedDifferent: false,
+		},
+		{
+			name:              "expanded IPv6 address",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "AAAA", 300, "2001:db8::1"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "AAAA", 300, "2001:0db8:0:0:0:0:0:1"),
+			expectedDifferent: false,
+		},
+		{
+			name:              "CNAME with trailing dot",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "CNAME", 300, "Foo.example.com"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "CNAME", 300, "foo.example.com."),
+			expectedDifferent: false,
+		},
+		{
+			name:              "quoted TXT",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "heritage=external-dns"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "\"heritage=external-dns\""),
+			expectedDifferent: false,
+		},
+		{
+			name:              "TXT case is significant",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "abc"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "TXT", 300, "ABC"),
+			expectedDifferent: true,
+		},
+		{
+			name:              "different target",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.2"),
+			expectedDifferent: true,
+		},
+		{
+			name:              "additional target",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1", "1.1.1.2"),
+			expectedDifferent: true,
+		},
+		{
+			name:              "different TTL",
+			givenOld:          endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+			givenNew:          endpoint.NewEndpointWithTTL("a.de", "A", 600, "1.1.1.1"),
+			expectedDifferent: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDifferent, endpointsAreDifferent(*tc.givenOld, *tc.givenNew))
+		})
+	}
+}
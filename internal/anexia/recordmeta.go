@@ -0,0 +1,166 @@
+package anexia
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// provider-specific properties with the metadata of the records at Anexia, which Records attaches to the endpoints
+const (
+	// providerSpecificRecordIDs holds the comma separated record identifiers, one per target in the order of the targets
+	providerSpecificRecordIDs = "webhook/anexia-record-ids"
+	// providerSpecificZone holds the zone of the records, multiple zones are comma separated
+	providerSpecificZone = "webhook/anexia-zone"
+	// providerSpecificImmutable is 'true' if at least one of the records is immutable
+	providerSpecificImmutable = "webhook/anexia-immutable"
+)
+
+// recordMetadataProperties are the properties which are copied from the current to the desired endpoints
+var recordMetadataProperties = []string{providerSpecificRecordIDs, providerSpecificZone, providerSpecificImmutable}
+
+// setRecordMetadata attaches the metadata of a record to the endpoint built from it
+func setRecordMetadata(ep *endpoint.Endpoint, record *anxcloudDns.Record) {
+	ep.SetProviderSpecificProperty(providerSpecificRecordIDs, record.Identifier)
+	ep.SetProviderSpecificProperty(providerSpecificZone, record.ZoneName)
+	if record.Immutable {
+		ep.SetProviderSpecificProperty(providerSpecificImmutable, "true")
+	}
+}
+
+// mergeRecordMetadata sets the metadata of the merged endpoint from the endpoints of the single records, which have
+// to be in the order of their targets
+func mergeRecordMetadata(merged *endpoint.Endpoint, group []*endpoint.Endpoint) {
+	ids := make([]string, 0, len(group))
+	zones := make(map[string]bool)
+	immutable := false
+	for _, ep := range group {
+		id, found := ep.GetProviderSpecificProperty(providerSpecificRecordIDs)
+		if !found {
+			return
+		}
+		ids = append(ids, id)
+		if zone, found := ep.GetProviderSpecificProperty(providerSpecificZone); found {
+			zones[zone] = true
+		}
+		if value, found := ep.GetProviderSpecificProperty(providerSpecificImmutable); found && value == "true" {
+			immutable = true
+		}
+	}
+	merged.SetProviderSpecificProperty(providerSpecificRecordIDs, strings.Join(ids, ","))
+	zoneNames := make([]string, 0, len(zones))
+	for zone := range zones {
+		zoneNames = append(zoneNames, zone)
+	}
+	sort.Strings(zoneNames)
+	merged.SetProviderSpecificProperty(providerSpecificZone, strings.Join(zoneNames, ","))
+	if immutable {
+		merged.SetProviderSpecificProperty(providerSpecificImmutable, "true")
+	} else {
+		merged.DeleteProviderSpecificProperty(providerSpecificImmutable)
+	}
+}
+
+// recordIDs returns the record identifiers of an endpoint, it reports false if they are missing or do not match
+// the targets
+func recordIDs(ep *endpoint.Endpoint) ([]string, bool) {
+	value, found := ep.GetProviderSpecificProperty(providerSpecificRecordIDs)
+	if !found || value == "" {
+		return nil, false
+	}
+	ids := strings.Split(value, ",")
+	if len(ids) != len(ep.Targets) {
+		return nil, false
+	}
+	return ids, true
+}
+
+// recordCache keeps the records and endpoints of the last call of Records. The endpoints are used to copy the
+// record metadata to the desired endpoints, so the metadata does not show up as change. The records are used to
+// verify the identifiers of endpoints to delete, the TXT registry copies the properties of an endpoint to its
+// ownership records, so an identifier is only trusted if the cached record matches the endpoint.
+type recordCache struct {
+	mu        sync.RWMutex
+	records   map[string]*anxcloudDns.Record
+	endpoints map[string]*endpoint.Endpoint
+	zones     map[string]bool
+}
+
+func (c *recordCache) update(records []*anxcloudDns.Record, endpoints []*endpoint.Endpoint) {
+	recordsByID := make(map[string]*anxcloudDns.Record, len(records))
+	zones := make(map[string]bool)
+	for _, record := range records {
+		recordsByID[record.Identifier] = record
+		zones[normalizeDomainName(record.ZoneName)] = true
+	}
+	endpointsByKey := make(map[string]*endpoint.Endpoint, len(endpoints))
+	for _, ep := range endpoints {
+		endpointsByKey[endpointKey(ep)] = ep
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = recordsByID
+	c.endpoints = endpointsByKey
+	c.zones = zones
+}
+
+// isZone reports whether the ASCII name is the apex of a zone with records
+func (c *recordCache) isZone(asciiName string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.zones[normalizeDomainName(asciiName)]
+}
+
+func (c *recordCache) record(id string) *anxcloudDns.Record {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.records[id]
+}
+
+func (c *recordCache) endpoint(key string) *endpoint.Endpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.endpoints[key]
+}
+
+func (c *recordCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.records, id)
+}
+
+// copyRecordMetadata copies the record metadata of the current endpoint with the same name, type and set identifier
+func (c *recordCache) copyRecordMetadata(ep *endpoint.Endpoint) {
+	current := c.endpoint(endpointKey(ep))
+	for _, name := range recordMetadataProperties {
+		ep.DeleteProviderSpecificProperty(name)
+		if current == nil {
+			continue
+		}
+		if value, found := current.GetProviderSpecificProperty(name); found {
+			ep.SetProviderSpecificProperty(name, value)
+		}
+	}
+}
+
+// recordsByID returns the cached records of an endpoint to delete by their identifiers. It reports false if any of
+// the identifiers is unknown or its record does not match the endpoint, then the records have to be looked up.
+func (c *recordCache) recordsByID(ep *endpoint.Endpoint, region string) ([]*anxcloudDns.Record, bool) {
+	ids, found := recordIDs(ep)
+	if !found {
+		return nil, false
+	}
+	records := make([]*anxcloudDns.Record, 0, len(ids))
+	for i, id := range ids {
+		record := c.record(id)
+		if record == nil || !strings.EqualFold(record.Type, ep.RecordType) || !regionsEqual(record.Region, region) ||
+			!rdataEqual(record.Type, record.RData, ep.Targets[i]) {
+			return nil, false
+		}
+		records = append(records, record)
+	}
+	return records, true
+}
@@ -0,0 +1,238 @@
+package anexia
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// supportedRecordTypes are the record types the provider manages, endpoints of other types are filtered out
+var supportedRecordTypes = map[string]bool{
+	endpoint.RecordTypeA:     true,
+	endpoint.RecordTypeAAAA:  true,
+	endpoint.RecordTypeCNAME: true,
+	endpoint.RecordTypeTXT:   true,
+	endpoint.RecordTypeMX:    true,
+	endpoint.RecordTypeNS:    true,
+	endpoint.RecordTypeSRV:   true,
+	endpoint.RecordTypePTR:   true,
+	"CAA":                    true,
+	"TLSA":                   true,
+	"SSHFP":                  true,
+	"SVCB":                   true,
+	"HTTPS":                  true,
+	"DS":                     true,
+}
+
+// strictRecordTypes are the record types whose rdata is validated before it is sent to Anexia
+var strictRecordTypes = map[string]bool{
+	"TLSA":  true,
+	"SSHFP": true,
+	"SVCB":  true,
+	"HTTPS": true,
+	"DS":    true,
+}
+
+// digest lengths in bytes by matching type, fingerprint type and digest type
+var (
+	tlsaDigestLengths  = map[uint8]int{1: 32, 2: 64}
+	sshfpDigestLengths = map[uint8]int{1: 20, 2: 32}
+	dsDigestLengths    = map[uint8]int{1: 20, 2: 32, 4: 48}
+)
+
+func isSupportedRecordType(recordType string) bool {
+	return supportedRecordTypes[strings.ToUpper(recordType)]
+}
+
+// recordScope decides which records the provider manages. A nil scope manages all supported record types, but never
+// the SOA and apex NS records which Anexia maintains for the zone itself.
+type recordScope struct {
+	types     map[string]bool
+	apexNSSOA bool
+}
+
+// newRecordScope returns the scope of the record types, no record types select all supported ones
+func newRecordScope(recordTypes []string, apexNSSOA bool) (*recordScope, error) {
+	scope := &recordScope{apexNSSOA: apexNSSOA}
+	for _, recordType := range recordTypes {
+		recordType = strings.ToUpper(strings.TrimSpace(recordType))
+		if recordType == "" {
+			continue
+		}
+		if !isSupportedRecordType(recordType) {
+			return nil, fmt.Errorf("managed record type %s is not supported, expected some of: %s", recordType, strings.Join(sortedKeys(supportedRecordTypes), ", "))
+		}
+		if scope.types == nil {
+			scope.types = make(map[string]bool)
+		}
+		scope.types[recordType] = true
+	}
+	return scope, nil
+}
+
+// managesType reports whether endpoints of the record type are managed
+func (s *recordScope) managesType(recordType string) bool {
+	if s == nil || s.types == nil {
+		return isSupportedRecordType(recordType)
+	}
+	return s.types[strings.ToUpper(recordType)]
+}
+
+// manages reports whether records of the type are managed, SOA and apex NS records only if enabled explicitly
+func (s *recordScope) manages(recordType string, apex bool) bool {
+	isSOA := strings.EqualFold(recordType, "SOA")
+	if isSOA || (apex && strings.EqualFold(recordType, endpoint.RecordTypeNS)) {
+		return s != nil && s.apexNSSOA && (isSOA || s.managesType(recordType))
+	}
+	return s.managesType(recordType)
+}
+
+// recordTypes returns the sorted managed record types
+func (s *recordScope) recordTypes() []string {
+	if s == nil || s.types == nil {
+		return sortedKeys(supportedRecordTypes)
+	}
+	return sortedKeys(s.types)
+}
+
+func sortedKeys(values map[string]bool) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateEndpoint checks that the record type of the endpoint is supported and that its targets are valid
+func validateEndpoint(ep *endpoint.Endpoint) error {
+	if !isSupportedRecordType(ep.RecordType) {
+		return fmt.Errorf("record type %s is not supported", ep.RecordType)
+	}
+	if _, err := endpointRegion(ep); err != nil {
+		return err
+	}
+	for _, target := range ep.Targets {
+		if err := validateRData(ep.RecordType, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRData checks the syntax of the rdata of the strictly validated record types
+func validateRData(recordType, rdata string) error {
+	recordType = strings.ToUpper(recordType)
+	if !strictRecordTypes[recordType] {
+		return nil
+	}
+	rr, err := parseRData(recordType, rdata)
+	if err != nil {
+		return err
+	}
+	switch rr := rr.(type) {
+	case *dns.TLSA:
+		if rr.Usage > 3 {
+			return fmt.Errorf("invalid TLSA certificate usage %d", rr.Usage)
+		}
+		if rr.Selector > 1 {
+			return fmt.Errorf("invalid TLSA selector %d", rr.Selector)
+		}
+		if rr.MatchingType > 2 {
+			return fmt.Errorf("invalid TLSA matching type %d", rr.MatchingType)
+		}
+		return validateDigest("TLSA certificate association data", rr.Certificate, tlsaDigestLengths[rr.MatchingType])
+	case *dns.SSHFP:
+		switch rr.Algorithm {
+		case 1, 2, 3, 4, 6:
+		default:
+			return fmt.Errorf("invalid SSHFP algorithm %d", rr.Algorithm)
+		}
+		length, ok := sshfpDigestLengths[rr.Type]
+		if !ok {
+			return fmt.Errorf("invalid SSHFP fingerprint type %d", rr.Type)
+		}
+		return validateDigest("SSHFP fingerprint", rr.FingerPrint, length)
+	case *dns.DS:
+		length, ok := dsDigestLengths[rr.DigestType]
+		if !ok {
+			return fmt.Errorf("invalid DS digest type %d", rr.DigestType)
+		}
+		return validateDigest("DS digest", rr.Digest, length)
+	case *dns.SVCB:
+		return validateSVCB(recordType, rr)
+	case *dns.HTTPS:
+		return validateSVCB(recordType, &rr.SVCB)
+	}
+	return nil
+}
+
+// validateDigest checks that the digest is hex encoded and, if the length is known, that it has the expected length
+func validateDigest(name, digest string, length int) error {
+	decoded, err := hex.DecodeString(digest)
+	if err != nil {
+		return fmt.Errorf("%s is not hex encoded", name)
+	}
+	if length > 0 && len(decoded) != length {
+		return fmt.Errorf("%s has %d bytes, expected %d", name, len(decoded), length)
+	}
+	return nil
+}
+
+func validateSVCB(recordType string, rr *dns.SVCB) error {
+	if rr.Priority == 0 && len(rr.Value) > 0 {
+		return fmt.Errorf("%s record in alias mode (priority 0) must not have parameters", recordType)
+	}
+	return nil
+}
+
+// parseRData parses the rdata in zone file syntax
+func parseRData(recordType, rdata string) (dns.RR, error) {
+	rr, err := dns.NewRR(fmt.Sprintf(". 3600 IN %s %s", recordType, rdata))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rdata '%s': %w", recordType, rdata, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("empty %s rdata", recordType)
+	}
+	return rr, nil
+}
+
+// canonicalStrictRData formats the rdata of the strictly validated record types for comparison: numbers without
+// leading zeros, digests in lower case hex and SVCB parameters sorted by key
+func canonicalStrictRData(recordType, rdata string) (string, bool) {
+	rr, err := parseRData(recordType, rdata)
+	if err != nil {
+		return "", false
+	}
+	switch rr := rr.(type) {
+	case *dns.TLSA:
+		return fmt.Sprintf("%d %d %d %s", rr.Usage, rr.Selector, rr.MatchingType, strings.ToLower(rr.Certificate)), true
+	case *dns.SSHFP:
+		return fmt.Sprintf("%d %d %s", rr.Algorithm, rr.Type, strings.ToLower(rr.FingerPrint)), true
+	case *dns.DS:
+		return fmt.Sprintf("%d %d %d %s", rr.KeyTag, rr.Algorithm, rr.DigestType, strings.ToLower(rr.Digest)), true
+	case *dns.SVCB:
+		return canonicalSVCB(rr), true
+	case *dns.HTTPS:
+		return canonicalSVCB(&rr.SVCB), true
+	}
+	return "", false
+}
+
+func canonicalSVCB(rr *dns.SVCB) string {
+	values := make([]dns.SVCBKeyValue, len(rr.Value))
+	copy(values, rr.Value)
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Key() < values[j].Key()
+	})
+	parts := []string{fmt.Sprintf("%d", rr.Priority), strings.ToLower(dns.Fqdn(rr.Target))}
+	for _, value := range values {
+		parts = append(parts, value.Key().String()+"="+value.String())
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,308 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+var (
+	sha256Hex = strings.Repeat("ab", 32)
+	sha1Hex   = strings.Repeat("cd", 20)
+)
+
+func TestValidateRData(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenType     string
+		givenRData    string
+		expectedError string
+	}{
+		{name: "TLSA", givenType: "TLSA", givenRData: "3 1 1 " + sha256Hex},
+		{name: "TLSA full certificate", givenType: "TLSA", givenRData: "3 0 0 3082010a0282010100"},
+		{name: "TLSA lower case type", givenType: "tlsa", givenRData: "3 1 1 " + sha256Hex},
+		{name: "TLSA invalid usage", givenType: "TLSA", givenRData: "4 1 1 " + sha256Hex, expectedError: "invalid TLSA certificate usage 4"},
+		{name: "TLSA invalid selector", givenType: "TLSA", givenRData: "3 2 1 " + sha256Hex, expectedError: "invalid TLSA selector 2"},
+		{name: "TLSA invalid matching type", givenType: "TLSA", givenRData: "3 1 3 " + sha256Hex, expectedError: "invalid TLSA matching type 3"},
+		{name: "TLSA wrong digest length", givenType: "TLSA", givenRData: "3 1 2 " + sha256Hex, expectedError: "TLSA certificate association data has 32 bytes, expected 64"},
+		{name: "TLSA not hex", givenType: "TLSA", givenRData: "3 1 1 xyz", expectedError: "TLSA certificate association data is not hex encoded"},
+		{name: "TLSA missing field", givenType: "TLSA", givenRData: "3 1", expectedError: "invalid TLSA rdata '3 1': dns: bad TLSA"},
+		{name: "SSHFP", givenType: "SSHFP", givenRData: "4 2 " + sha256Hex},
+		{name: "SSHFP SHA-1", givenType: "SSHFP", givenRData: "1 1 " + sha1Hex},
+		{name: "SSHFP invalid algorithm", givenType: "SSHFP", givenRData: "5 2 " + sha256Hex, expectedError: "invalid SSHFP algorithm 5"},
+		{name: "SSHFP invalid type", givenType: "SSHFP", givenRData: "4 3 " + sha256Hex, expectedError: "invalid SSHFP fingerprint type 3"},
+		{name: "SSHFP wrong digest length", givenType: "SSHFP", givenRData: "4 1 " + sha256Hex, expectedError: "SSHFP fingerprint has 32 bytes, expected 20"},
+		{name: "DS", givenType: "DS", givenRData: "12345 13 2 " + sha256Hex},
+		{name: "DS invalid digest type", givenType: "DS", givenRData: "12345 13 3 " + sha256Hex, expectedError: "invalid DS digest type 3"},
+		{name: "DS wrong digest length", givenType: "DS", givenRData: "12345 13 1 " + sha256Hex, expectedError: "DS digest has 32 bytes, expected 20"},
+		{name: "HTTPS service mode", givenType: "HTTPS", givenRData: "1 . alpn=h2,h3 port=443"},
+		{name: "HTTPS alias mode", givenType: "HTTPS", givenRData: "0 www.example.com."},
+		{name: "HTTPS alias mode with parameters", givenType: "HTTPS", givenRData: "0 www.example.com. alpn=h2", expectedError: "HTTPS record in alias mode (priority 0) must not have parameters"},
+		{name: "HTTPS unknown parameter", givenType: "HTTPS", givenRData: "1 . foo=bar", expectedError: "invalid HTTPS rdata '1 . foo=bar': dns: bad SVCB key"},
+		{name: "SVCB", givenType: "SVCB", givenRData: "1 svc.example.com. port=8443"},
+		{name: "empty rdata", givenType: "DS", givenRData: "", expectedError: "invalid DS rdata '': dns: bad DS"},
+		{name: "A is not validated", givenType: "A", givenRData: "anything"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRData(tc.givenType, tc.givenRData)
+			if tc.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+}
+
+func TestCanonicalStrictRData(t *testing.T) {
+	testCases := []struct {
+		name       string
+		givenType  string
+		givenA     string
+		givenB     string
+		expectSame bool
+	}{
+		{name: "TLSA hex case", givenType: "TLSA", givenA: "3 1 1 " + strings.ToUpper(sha256Hex), givenB: "3 1 1 " + sha256Hex, expectSame: true},
+		{name: "TLSA leading zeros", givenType: "TLSA", givenA: "03 01 01 " + sha256Hex, givenB: "3 1 1 " + sha256Hex, expectSame: true},
+		{name: "TLSA different usage", givenType: "TLSA", givenA: "2 1 1 " + sha256Hex, givenB: "3 1 1 " + sha256Hex, expectSame: false},
+		{name: "SSHFP hex case", givenType: "SSHFP", givenA: "4 2 " + strings.ToUpper(sha256Hex), givenB: "4 2 " + sha256Hex, expectSame: true},
+		{name: "DS hex case", givenType: "DS", givenA: "12345 13 2 " + strings.ToUpper(sha256Hex), givenB: "12345 13 2 " + sha256Hex, expectSame: true},
+		{name: "HTTPS parameter order", givenType: "HTTPS", givenA: "1 . port=443 alpn=h2", givenB: "1 . alpn=h2 port=443", expectSame: true},
+		{name: "HTTPS target case", givenType: "HTTPS", givenA: "1 SVC.example.com.", givenB: "1 svc.example.com.", expectSame: true},
+		{name: "HTTPS different port", givenType: "HTTPS", givenA: "1 . port=443", givenB: "1 . port=8443", expectSame: false},
+		{name: "SVCB and HTTPS formats", givenType: "SVCB", givenA: "1  svc.example.com.  port=8443", givenB: "1 svc.example.com. port=8443", expectSame: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectSame, rdataEqual(tc.givenType, tc.givenA, tc.givenB))
+		})
+	}
+}
+
+func TestAdjustEndpointsFiltersRecordTypes(t *testing.T) {
+	provider := &Provider{}
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("_443._tcp.a.de", "TLSA", 300, "3 1 1 "+sha256Hex),
+		endpoint.NewEndpointWithTTL("_443._tcp.b.de", "TLSA", 300, "3 1 9 "+sha256Hex),
+		endpoint.NewEndpointWithTTL("a.de", "HTTPS", 300, "1 . alpn=h2"),
+		endpoint.NewEndpointWithTTL("a.de", "NAPTR", 300, "100 10 \"u\" \"E2U+sip\" \"!^.*$!sip:info@a.de!\" ."),
+		endpoint.NewEndpointWithTTL("a.de", "DS", 300, "12345 13 2 "+sha256Hex),
+		endpoint.NewEndpointWithTTL("a.de", "SSHFP", 300, "4 2 "+sha256Hex),
+	}
+
+	adjusted, err := provider.AdjustEndpoints(endpoints)
+	require.NoError(t, err)
+	recordTypes := make([]string, 0)
+	for _, ep := range adjusted {
+		recordTypes = append(recordTypes, ep.DNSName+" "+ep.RecordType)
+	}
+	assert.Equal(t, []string{"a.de A", "_443._tcp.a.de TLSA", "a.de HTTPS", "a.de DS", "a.de SSHFP"}, recordTypes)
+}
+
+func TestApplyChangesRecordTypes(t *testing.T) {
+	ctx := context.Background()
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "a.de" }),
+	}
+	provider := &Provider{client: mockDNSClient}
+
+	err := provider.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("_443._tcp.a.de", "TLSA", 300, "3 1 1 "+sha256Hex),
+			endpoint.NewEndpointWithTTL("_25._tcp.a.de", "TLSA", 300, "3 1 1 abc"),
+			endpoint.NewEndpointWithTTL("a.de", "NAPTR", 300, "100 10 \"u\" \"E2U+sip\" \"\" ."),
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, mockDNSClient.createdRecords["a.de"], 1)
+	assert.Equal(t, "_443._tcp", mockDNSClient.createdRecords["a.de"][0].Name)
+
+	mockDNSClient.createError = fmt.Errorf("400 Bad Request: invalid type")
+	err = provider.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "HTTPS", 300, "1 . alpn=h2"),
+		},
+	})
+	assert.EqualError(t, err, "the Anexia API rejected the HTTPS record '@' in zone a.de: 400 Bad Request: invalid type")
+}
+
+func TestRecordsKeepStrictRecordTypes(t *testing.T) {
+	mockDNSClient := &mockDNSClient{
+		allRecords: []*anxcloudDns.Record{
+			{Name: "_443._tcp", ZoneName: "a.de", Type: "TLSA", TTL: 300, RData: "3 1 1 " + strings.ToUpper(sha256Hex)},
+		},
+	}
+	provider := &Provider{client: mockDNSClient}
+	endpoints, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.False(t, endpointsAreDifferent(*endpoints[0], *endpoint.NewEndpointWithTTL("_443._tcp.a.de", "TLSA", 300, "3 1 1 "+sha256Hex)))
+}
+
+func TestNewRecordScope(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenTypes    []string
+		expectedTypes []string
+		expectedError string
+	}{
+		{name: "all supported types by default", expectedTypes: sortedKeys(supportedRecordTypes)},
+		{name: "selected types", givenTypes: []string{"cname", " A", "", "TXT"}, expectedTypes: []string{"A", "CNAME", "TXT"}},
+		{
+			name:          "unsupported type",
+			givenTypes:    []string{"A", "NAPTR"},
+			expectedError: "managed record type NAPTR is not supported, expected some of: A, AAAA, CAA, CNAME, DS, HTTPS, MX, NS, PTR, SRV, SSHFP, SVCB, TLSA, TXT",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scope, err := newRecordScope(tc.givenTypes, false)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTypes, scope.recordTypes())
+		})
+	}
+}
+
+func TestRecordScopeManages(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenScope    *recordScope
+		givenType     string
+		givenApex     bool
+		expectManaged bool
+	}{
+		{name: "default scope", givenType: "A", expectManaged: true},
+		{name: "default scope excludes apex NS", givenType: "NS", givenApex: true},
+		{name: "default scope keeps delegations", givenType: "NS", expectManaged: true},
+		{name: "default scope excludes SOA", givenType: "SOA"},
+		{name: "type not selected", givenScope: &recordScope{types: map[string]bool{"A": true}}, givenType: "TXT"},
+		{name: "apex NS enabled", givenScope: &recordScope{apexNSSOA: true}, givenType: "NS", givenApex: true, expectManaged: true},
+		{name: "apex SOA enabled", givenScope: &recordScope{apexNSSOA: true}, givenType: "SOA", givenApex: true, expectManaged: true},
+		{
+			name:       "apex NS enabled but NS not selected",
+			givenScope: &recordScope{types: map[string]bool{"A": true}, apexNSSOA: true},
+			givenType:  "NS",
+			givenApex:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectManaged, tc.givenScope.manages(tc.givenType, tc.givenApex))
+		})
+	}
+}
+
+func TestManagedRecordTypes(t *testing.T) {
+	ctx := context.Background()
+	records := []*anxcloudDns.Record{
+		{Identifier: "soa", Name: "@", ZoneName: "a.de", Type: "SOA", TTL: 3600, RData: "ns1.anexia.com. hostmaster.a.de. 1 14400 3600 604800 300"},
+		{Identifier: "ns", Name: "@", ZoneName: "a.de", Type: "NS", TTL: 3600, RData: "ns1.anexia.com."},
+		{Identifier: "a", Name: "www", ZoneName: "a.de", Type: "A", TTL: 300, RData: "192.0.2.1"},
+		{Identifier: "mx", Name: "@", ZoneName: "a.de", Type: "MX", TTL: 300, RData: "10 mail.a.de."},
+	}
+	mockDNSClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": records},
+	}
+	scope, err := newRecordScope([]string{"A", "NS"}, false)
+	require.NoError(t, err)
+	provider := &Provider{client: mockDNSClient, scope: scope}
+
+	endpoints, err := provider.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "www.a.de", endpoints[0].DNSName)
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.de", "NS", 3600, "ns2.anexia.com"),
+		endpoint.NewEndpointWithTTL("sub.a.de", "NS", 3600, "ns1.other.com"),
+		endpoint.NewEndpointWithTTL("a.de", "MX", 300, "10 mail.a.de"),
+		endpoint.NewEndpointWithTTL("app.a.de", "A", 300, "192.0.2.2"),
+	})
+	require.NoError(t, err)
+	names := make([]string, 0, len(adjusted))
+	for _, ep := range adjusted {
+		names = append(names, ep.DNSName+" "+ep.RecordType)
+	}
+	assert.Equal(t, []string{"sub.a.de NS", "app.a.de A"}, names)
+
+	require.NoError(t, provider.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "NS", 3600, "ns2.anexia.com"),
+			endpoint.NewEndpointWithTTL("app.a.de", "A", 300, "192.0.2.2"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "NS", 3600, "ns1.anexia.com"),
+			endpoint.NewEndpointWithTTL("a.de", "MX", 300, "10 mail.a.de"),
+		},
+	}))
+	require.Len(t, mockDNSClient.createdRecords["a.de"], 1)
+	assert.Equal(t, "app", mockDNSClient.createdRecords["a.de"][0].Name)
+	assert.Empty(t, mockDNSClient.deletedRecords)
+	assert.Equal(t, map[string]string{"X-Managed-Record-Types": "A,NS", "X-Managed-Apex-NS-SOA": "false"}, provider.NegotiationHeaders())
+}
+
+func TestManagedRecordTypesInternationalizedApex(t *testing.T) {
+	records := []*anxcloudDns.Record{
+		{Identifier: "ns", Name: "@", ZoneName: "xn--bcher-kva.de", Type: "NS", TTL: 3600, RData: "ns1.anexia.com."},
+		{Identifier: "a", Name: "www", ZoneName: "xn--bcher-kva.de", Type: "A", TTL: 300, RData: "192.0.2.1"},
+	}
+	provider := &Provider{client: &mockDNSClient{allRecords: records}}
+	_, err := provider.Records(context.Background())
+	require.NoError(t, err)
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("bücher.de", "NS", 3600, "ns2.anexia.com"),
+		endpoint.NewEndpointWithTTL("xn--bcher-kva.de", "NS", 3600, "ns2.anexia.com"),
+		endpoint.NewEndpointWithTTL("sub.bücher.de", "NS", 3600, "ns1.other.com"),
+	})
+	require.NoError(t, err)
+	require.Len(t, adjusted, 1, "apex NS records of internationalized zones are not managed")
+	assert.Equal(t, "sub.bücher.de", adjusted[0].DNSName)
+}
+
+func TestApplyChangesNeverChangesSOA(t *testing.T) {
+	records := []*anxcloudDns.Record{
+		{Identifier: "soa", Name: "@", ZoneName: "a.de", Type: "SOA", TTL: 3600, RData: "ns1.anexia.com. hostmaster.a.de. 1 14400 3600 604800 300"},
+		{Identifier: "ns", Name: "@", ZoneName: "a.de", Type: "NS", TTL: 3600, RData: "ns1.anexia.com."},
+	}
+	mockDNSClient := &mockDNSClient{
+		allRecords:  records,
+		allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": records},
+	}
+	provider := &Provider{client: mockDNSClient, scope: &recordScope{apexNSSOA: true}}
+	current, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	require.Len(t, current, 2, "SOA records are reported")
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: current,
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.de", "NS", 3600, "ns2.anexia.com"),
+			endpoint.NewEndpointWithTTL("a.de", "SOA", 3600, "ns1.anexia.com. hostmaster.a.de. 2 14400 3600 604800 300"),
+		},
+	}))
+	assert.Equal(t, []string{"ns"}, mockDNSClient.deletedRecords["a.de"])
+	require.Len(t, mockDNSClient.createdRecords["a.de"], 1)
+	assert.Equal(t, "NS", mockDNSClient.createdRecords["a.de"][0].Type)
+}
@@ -0,0 +1,42 @@
+package anexia
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// providerSpecificRegion is the endpoint property holding the Anexia region of geo-aware records
+const providerSpecificRegion = "webhook/anexia-region"
+
+// endpointRegion returns the Anexia region of an endpoint. It is taken from the provider-specific property and
+// falls back to the set identifier, so multiple region-specific record sets can share one name. An empty region
+// means the records answer for all clients without a more specific region.
+func endpointRegion(ep *endpoint.Endpoint) (string, error) {
+	region, found := ep.GetProviderSpecificProperty(providerSpecificRegion)
+	region = strings.TrimSpace(region)
+	if !found || region == "" {
+		return ep.SetIdentifier, nil
+	}
+	if ep.SetIdentifier != "" && ep.SetIdentifier != region {
+		return "", fmt.Errorf("set identifier '%s' does not match the region '%s'", ep.SetIdentifier, region)
+	}
+	return region, nil
+}
+
+// setEndpointRegion sets the region as set identifier and provider-specific property, which is how Records reports
+// regions, so desired and current endpoints compare equal
+func setEndpointRegion(ep *endpoint.Endpoint, region string) {
+	if region == "" {
+		ep.DeleteProviderSpecificProperty(providerSpecificRegion)
+		return
+	}
+	ep.SetIdentifier = region
+	ep.SetProviderSpecificProperty(providerSpecificRegion, region)
+}
+
+// regionsEqual compares the region of a record with the region of an endpoint
+func regionsEqual(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
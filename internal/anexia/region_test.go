@@ -0,0 +1,73 @@
+package anexia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestEndpointRegion(t *testing.T) {
+	testCases := []struct {
+		name           string
+		givenEndpoint  *endpoint.Endpoint
+		expectedRegion string
+		expectedError  string
+	}{
+		{
+			name:           "no region",
+			givenEndpoint:  endpoint.NewEndpoint("a.de", "A", "1.1.1.1"),
+			expectedRegion: "",
+		},
+		{
+			name:           "region from the set identifier",
+			givenEndpoint:  endpoint.NewEndpoint("a.de", "A", "1.1.1.1").WithSetIdentifier("eu"),
+			expectedRegion: "eu",
+		},
+		{
+			name:           "region from the provider-specific property",
+			givenEndpoint:  endpoint.NewEndpoint("a.de", "A", "1.1.1.1").WithProviderSpecific(providerSpecificRegion, " eu "),
+			expectedRegion: "eu",
+		},
+		{
+			name: "same region in both",
+			givenEndpoint: endpoint.NewEndpoint("a.de", "A", "1.1.1.1").WithSetIdentifier("eu").
+				WithProviderSpecific(providerSpecificRegion, "eu"),
+			expectedRegion: "eu",
+		},
+		{
+			name: "different regions",
+			givenEndpoint: endpoint.NewEndpoint("a.de", "A", "1.1.1.1").WithSetIdentifier("us").
+				WithProviderSpecific(providerSpecificRegion, "eu"),
+			expectedError: "set identifier 'us' does not match the region 'eu'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			region, err := endpointRegion(tc.givenEndpoint)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedRegion, region)
+		})
+	}
+}
+
+func TestAdjustEndpointsSetsRegion(t *testing.T) {
+	provider := &Provider{}
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("a.de", "A", "1.1.1.1").WithSetIdentifier("eu"),
+		endpoint.NewEndpoint("b.de", "A", "1.1.1.1").WithProviderSpecific(providerSpecificRegion, "us"),
+		endpoint.NewEndpoint("c.de", "A", "1.1.1.1").WithSetIdentifier("us").WithProviderSpecific(providerSpecificRegion, "eu"),
+	})
+	require.NoError(t, err)
+	require.Len(t, endpoints, 2, "the endpoint with conflicting regions is rejected")
+	assert.Equal(t, "eu", endpoints[0].SetIdentifier)
+	assert.Equal(t, endpoint.ProviderSpecific{{Name: providerSpecificRegion, Value: "eu"}}, endpoints[0].ProviderSpecific)
+	assert.Equal(t, "us", endpoints[1].SetIdentifier)
+	assert.Equal(t, endpoint.ProviderSpecific{{Name: providerSpecificRegion, Value: "us"}}, endpoints[1].ProviderSpecific)
+}
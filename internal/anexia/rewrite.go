@@ -0,0 +1,249 @@
+package anexia
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/yaml"
+)
+
+// rewriteRule maps names between external-dns and Anexia, either by replacing a suffix or with a regular expression.
+// Regular expressions can not be reversed automatically, so they need the reverse expression and examples, which
+// are checked to map back to themselves.
+type rewriteRule struct {
+	Suffix       string   `json:"suffix,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	To           string   `json:"to"`
+	ReverseRegex string   `json:"reverseRegex,omitempty"`
+	ReverseTo    string   `json:"reverseTo,omitempty"`
+	Examples     []string `json:"examples,omitempty"`
+
+	forward *regexp.Regexp
+	reverse *regexp.Regexp
+}
+
+// rewriter rewrites the names of external-dns to the names at Anexia and back, the first matching rule wins
+type rewriter struct {
+	rules []*rewriteRule
+}
+
+// loadRewriteRules reads the rewrite rules from a YAML or JSON file
+func loadRewriteRules(path string) (*rewriter, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite rules: %w", err)
+	}
+	rules := make([]*rewriteRule, 0)
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode rewrite rules: %w", err)
+	}
+	r, err := newRewriter(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules: %w", err)
+	}
+	return r, nil
+}
+
+// newRewriter validates the rules and rejects rule sets which can not be reversed
+func newRewriter(rules []*rewriteRule) (*rewriter, error) {
+	for i, rule := range rules {
+		if err := rule.init(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	r := &rewriter{rules: rules}
+	if err := r.checkReversible(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rewriteRule) init() error {
+	switch {
+	case r.Suffix != "" && r.Regex != "":
+		return errors.New("a rule has either a suffix or a regex")
+	case r.Suffix != "":
+		if r.ReverseRegex != "" || r.ReverseTo != "" {
+			return errors.New("suffix rules are reversed automatically, they must not have a reverse regex")
+		}
+		r.Suffix = normalizeRewriteName(r.Suffix)
+		r.To = normalizeRewriteName(r.To)
+		if r.Suffix == "" || r.To == "" {
+			return errors.New("suffix rules need a suffix and a replacement")
+		}
+		if r.Suffix == r.To {
+			return fmt.Errorf("suffix %s is replaced by itself", r.Suffix)
+		}
+		// the rule is checked with a name below the suffix and the suffix itself
+		r.Examples = append(r.Examples, "example."+r.Suffix, r.Suffix)
+	case r.Regex != "":
+		if r.ReverseRegex == "" || r.ReverseTo == "" {
+			return errors.New("regex rules can not be reversed automatically, they need a reverse regex and replacement")
+		}
+		if len(r.Examples) == 0 {
+			return errors.New("regex rules need examples to check that they can be reversed")
+		}
+		var err error
+		if r.forward, err = regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		if r.reverse, err = regexp.Compile(r.ReverseRegex); err != nil {
+			return fmt.Errorf("invalid reverse regex: %w", err)
+		}
+		for i, example := range r.Examples {
+			r.Examples[i] = normalizeRewriteName(example)
+			if !r.forward.MatchString(r.Examples[i]) {
+				return fmt.Errorf("the example %s does not match the regex", example)
+			}
+		}
+	default:
+		return errors.New("a rule needs a suffix or a regex")
+	}
+	return nil
+}
+
+// checkReversible checks that no two rules produce names in the same domain and that all examples map back to
+// themselves with the complete rule set
+func (r *rewriter) checkReversible() error {
+	for i, a := range r.rules {
+		for _, b := range r.rules[i+1:] {
+			if a.Suffix == "" || b.Suffix == "" {
+				continue
+			}
+			if isSubdomainOf(a.To, b.To) || isSubdomainOf(b.To, a.To) {
+				return fmt.Errorf("the suffixes %s and %s are both replaced within %s and %s, so they can not be reversed", a.Suffix, b.Suffix, a.To, b.To)
+			}
+		}
+	}
+	for _, rule := range r.rules {
+		for _, example := range rule.Examples {
+			rewritten := r.rewrite(example)
+			reversed, ok := r.reverse(rewritten)
+			if !ok || reversed != example {
+				return fmt.Errorf("%s is rewritten to %s, which is not reversed to %s", example, rewritten, example)
+			}
+		}
+	}
+	return nil
+}
+
+// rewrite returns the name at Anexia for a name of external-dns
+func (r *rewriter) rewrite(name string) string {
+	name = normalizeRewriteName(name)
+	for _, rule := range r.rules {
+		if rewritten, ok := rule.apply(name); ok {
+			return rewritten
+		}
+	}
+	return name
+}
+
+// reverse returns the name of external-dns for a name at Anexia. It reports false for names which no rule produces,
+// but which a rule would rewrite, as external-dns can not manage them.
+func (r *rewriter) reverse(name string) (string, bool) {
+	name = normalizeRewriteName(name)
+	for _, rule := range r.rules {
+		if reversed, ok := rule.unapply(name); ok {
+			return reversed, true
+		}
+	}
+	for _, rule := range r.rules {
+		if _, ok := rule.apply(name); ok {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+func (r *rewriteRule) apply(name string) (string, bool) {
+	if r.forward != nil {
+		if !r.forward.MatchString(name) {
+			return "", false
+		}
+		return normalizeRewriteName(r.forward.ReplaceAllString(name, r.To)), true
+	}
+	return replaceSuffix(name, r.Suffix, r.To)
+}
+
+func (r *rewriteRule) unapply(name string) (string, bool) {
+	if r.reverse != nil {
+		if !r.reverse.MatchString(name) {
+			return "", false
+		}
+		return normalizeRewriteName(r.reverse.ReplaceAllString(name, r.ReverseTo)), true
+	}
+	return replaceSuffix(name, r.To, r.Suffix)
+}
+
+// checkRoundTrip checks that the name at Anexia of a desired name maps back to it, otherwise Records would never
+// report the desired name and external-dns would try to create it on every sync
+func (r *rewriter) checkRoundTrip(name string) error {
+	rewritten := r.rewrite(name)
+	reversed, ok := r.reverse(rewritten)
+	if !ok || reversed != normalizeRewriteName(name) {
+		return fmt.Errorf("it is rewritten to %s, which is not reversed to %s", rewritten, name)
+	}
+	return nil
+}
+
+// rewriteEndpoints returns copies of the endpoints with the names at Anexia
+func (r *rewriter) rewriteEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	rewritten := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		name := r.rewrite(ep.DNSName)
+		if name == normalizeRewriteName(ep.DNSName) {
+			rewritten = append(rewritten, ep)
+			continue
+		}
+		log.Debugf("rewriting %s record %s to %s", ep.RecordType, ep.DNSName, name)
+		copied := *ep
+		copied.DNSName = name
+		rewritten = append(rewritten, &copied)
+	}
+	return rewritten
+}
+
+// reverseEndpoints sets the names of external-dns on the endpoints read from Anexia, endpoints which external-dns
+// can not manage are left out
+func (r *rewriter) reverseEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	reversed := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		name, ok := r.reverse(ep.DNSName)
+		if !ok {
+			log.Debugf("skipping %s record %s, its name is rewritten by the rewrite rules", ep.RecordType, ep.DNSName)
+			continue
+		}
+		ep.DNSName = name
+		reversed = append(reversed, ep)
+	}
+	sortEndpoints(reversed)
+	return reversed
+}
+
+// replaceSuffix replaces the suffix of a name, the suffix has to match whole labels
+func replaceSuffix(name, suffix, replacement string) (string, bool) {
+	if name == suffix {
+		return replacement, true
+	}
+	if strings.HasSuffix(name, "."+suffix) {
+		return strings.TrimSuffix(name, suffix) + replacement, true
+	}
+	return "", false
+}
+
+func isSubdomainOf(name, domain string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// normalizeRewriteName brings names into the form the rules work on, lower case unicode without trailing dot
+func normalizeRewriteName(name string) string {
+	if unicodeName, err := toUnicodeName(name); err == nil {
+		return unicodeName
+	}
+	return normalizeDomainName(name)
+}
@@ -0,0 +1,186 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const testRewriteRules = `
+- suffix: internal.corp
+  to: corp-internal.example.com
+- regex: '^(.+)\.k8s\.local$'
+  to: '${1}.apps.example.com'
+  reverseRegex: '^(.+)\.apps\.example\.com$'
+  reverseTo: '${1}.k8s.local'
+  examples: [web.k8s.local, api.team.k8s.local]
+`
+
+func TestLoadRewriteRules(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenRules    string
+		expectedError string
+	}{
+		{name: "valid rules", givenRules: testRewriteRules},
+		{name: "no rules", givenRules: "[]"},
+		{
+			name:          "unknown field",
+			givenRules:    "- suffix: a.de\n  replacement: b.de\n",
+			expectedError: `failed to decode rewrite rules: error unmarshaling JSON: while decoding JSON: json: unknown field "replacement"`,
+		},
+		{
+			name:          "suffix and regex",
+			givenRules:    "- suffix: a.de\n  regex: '^a$'\n  to: b.de\n",
+			expectedError: "invalid rewrite rules: rule 1: a rule has either a suffix or a regex",
+		},
+		{
+			name:          "suffix replaced by itself",
+			givenRules:    "- suffix: a.de\n  to: A.de.\n",
+			expectedError: "invalid rewrite rules: rule 1: suffix a.de is replaced by itself",
+		},
+		{
+			name:          "regex without reverse",
+			givenRules:    "- regex: '^(.+)\\.a\\.de$'\n  to: '${1}.b.de'\n  examples: [x.a.de]\n",
+			expectedError: "invalid rewrite rules: rule 1: regex rules can not be reversed automatically, they need a reverse regex and replacement",
+		},
+		{
+			name:          "regex without examples",
+			givenRules:    "- regex: '^(.+)\\.a\\.de$'\n  to: '${1}.b.de'\n  reverseRegex: '^(.+)\\.b\\.de$'\n  reverseTo: '${1}.a.de'\n",
+			expectedError: "invalid rewrite rules: rule 1: regex rules need examples to check that they can be reversed",
+		},
+		{
+			name:          "example not matching the regex",
+			givenRules:    "- regex: '^(.+)\\.a\\.de$'\n  to: '${1}.b.de'\n  reverseRegex: '^(.+)\\.b\\.de$'\n  reverseTo: '${1}.a.de'\n  examples: [x.c.de]\n",
+			expectedError: "invalid rewrite rules: rule 1: the example x.c.de does not match the regex",
+		},
+		{
+			name:          "regex which loses information",
+			givenRules:    "- regex: '^(.+)\\.(.+)\\.a\\.de$'\n  to: '${2}.b.de'\n  reverseRegex: '^(.+)\\.b\\.de$'\n  reverseTo: 'www.${1}.a.de'\n  examples: [api.team.a.de]\n",
+			expectedError: "invalid rewrite rules: api.team.a.de is rewritten to team.b.de, which is not reversed to api.team.a.de",
+		},
+		{
+			name:          "suffixes replaced within the same domain",
+			givenRules:    "- suffix: a.de\n  to: example.com\n- suffix: b.de\n  to: b.example.com\n",
+			expectedError: "invalid rewrite rules: the suffixes a.de and b.de are both replaced within example.com and b.example.com, so they can not be reversed",
+		},
+		{
+			name:          "regex and suffix replaced within the same domain",
+			givenRules:    "- regex: '^(.+)\\.a\\.de$'\n  to: '${1}.b.de'\n  reverseRegex: '^(.+)\\.b\\.de$'\n  reverseTo: '${1}.a.de'\n  examples: [x.a.de]\n- suffix: c.de\n  to: b.de\n",
+			expectedError: "invalid rewrite rules: example.c.de is rewritten to example.b.de, which is not reversed to example.c.de",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadRewriteRules(writeTestFile(t, "rewrite.yaml", tc.givenRules))
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	rewriting, err := loadRewriteRules(writeTestFile(t, "rewrite.yaml", testRewriteRules))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name              string
+		givenName         string
+		expectedRewritten string
+	}{
+		{name: "below the suffix", givenName: "app.internal.corp", expectedRewritten: "app.corp-internal.example.com"},
+		{name: "the suffix itself", givenName: "internal.corp", expectedRewritten: "corp-internal.example.com"},
+		{name: "trailing dot and upper case", givenName: "App.Internal.Corp.", expectedRewritten: "app.corp-internal.example.com"},
+		{name: "suffix matches whole labels only", givenName: "appinternal.corp", expectedRewritten: "appinternal.corp"},
+		{name: "regex", givenName: "api.team.k8s.local", expectedRewritten: "api.team.apps.example.com"},
+		{name: "no rule", givenName: "www.example.com", expectedRewritten: "www.example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rewritten := rewriting.rewrite(tc.givenName)
+			assert.Equal(t, tc.expectedRewritten, rewritten)
+			reversed, ok := rewriting.reverse(rewritten)
+			assert.True(t, ok)
+			assert.Equal(t, normalizeRewriteName(tc.givenName), reversed)
+		})
+	}
+
+	t.Run("names which a rule rewrites are not reversed", func(t *testing.T) {
+		_, ok := rewriting.reverse("app.internal.corp")
+		assert.False(t, ok)
+	})
+}
+
+func TestApplyChangesRewrite(t *testing.T) {
+	rewriting, err := loadRewriteRules(writeTestFile(t, "rewrite.yaml", testRewriteRules))
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(2, func(i int) string {
+			return []string{"corp-internal.example.com", "internal.corp"}[i]
+		}),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"corp-internal.example.com": {{Identifier: "old", ZoneName: "corp-internal.example.com", Name: "old", Type: "A", RData: "192.0.2.1"}},
+		},
+	}
+	provider := &Provider{client: mockDNSClient, rewriting: rewriting, domainFilter: endpoint.NewDomainFilter([]string{"internal.corp"})}
+	desired := endpoint.NewEndpointWithTTL("new.internal.corp", "A", 300, "192.0.2.2")
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{desired},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.internal.corp", "A", 300, "192.0.2.1")},
+	}))
+
+	require.Len(t, mockDNSClient.createdRecords["corp-internal.example.com"], 1)
+	assert.Equal(t, "new", mockDNSClient.createdRecords["corp-internal.example.com"][0].Name)
+	assert.Empty(t, mockDNSClient.createdRecords["internal.corp"])
+	assert.Equal(t, map[string][]string{"corp-internal.example.com": {"old"}}, mockDNSClient.deletedRecords)
+	assert.Equal(t, "new.internal.corp", desired.DNSName, "the endpoints of the plan must not be changed")
+}
+
+func TestRecordsRewrite(t *testing.T) {
+	rewriting, err := loadRewriteRules(writeTestFile(t, "rewrite.yaml", testRewriteRules))
+	require.NoError(t, err)
+	provider := &Provider{
+		client: &mockDNSClient{allRecords: []*anxcloudDns.Record{
+			{Identifier: "1", ZoneName: "corp-internal.example.com", Name: "www", Type: "A", RData: "192.0.2.1", TTL: 300},
+			{Identifier: "2", ZoneName: "internal.corp", Name: "shadowed", Type: "A", RData: "192.0.2.2", TTL: 300},
+			{Identifier: "3", ZoneName: "corp-internal.example.com", Name: "", Type: "TXT", RData: "\"apex\"", TTL: 300},
+			{Identifier: "4", ZoneName: "other.com", Name: "www", Type: "A", RData: "192.0.2.3", TTL: 300},
+		}},
+		rewriting:    rewriting,
+		domainFilter: endpoint.NewDomainFilter([]string{"internal.corp"}),
+	}
+
+	endpoints, err := provider.Records(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []*endpoint.Endpoint{
+		{DNSName: "internal.corp", RecordType: "TXT", RecordTTL: 300, Targets: endpoint.Targets{"apex"}},
+		{DNSName: "www.internal.corp", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"192.0.2.1"}},
+	}, withoutRecordMetadata(endpoints))
+}
+
+func TestAdjustEndpointsRejectsNamesWhichCanNotBeReversed(t *testing.T) {
+	rewriting, err := loadRewriteRules(writeTestFile(t, "rewrite.yaml", testRewriteRules))
+	require.NoError(t, err)
+	provider := &Provider{rewriting: rewriting}
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.internal.corp", "A", "192.0.2.1"),
+		endpoint.NewEndpoint("www.corp-internal.example.com", "A", "192.0.2.2"),
+	})
+	require.NoError(t, err)
+
+	require.Len(t, adjusted, 1)
+	assert.Equal(t, "www.internal.corp", adjusted[0].DNSName)
+}
@@ -0,0 +1,32 @@
+package anexia
+
+import (
+	"context"
+
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+// zoneSnapshot holds the records of the zones touched by one change, so that the checks of the planned records
+// fetch each zone only once and all of them see the same contents
+type zoneSnapshot struct {
+	client  DNSService
+	records map[string][]*anxcloudDns.Record
+}
+
+func newZoneSnapshot(client DNSService) *zoneSnapshot {
+	return &zoneSnapshot{client: client, records: make(map[string][]*anxcloudDns.Record)}
+}
+
+// zoneRecords returns the records of the zone, they are fetched on first use. The returned slice is shared and must
+// not be modified.
+func (s *zoneSnapshot) zoneRecords(ctx context.Context, zoneName string) ([]*anxcloudDns.Record, error) {
+	if records, found := s.records[zoneName]; found {
+		return records, nil
+	}
+	records, err := s.client.GetZoneRecords(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+	s.records[zoneName] = records
+	return records, nil
+}
@@ -0,0 +1,70 @@
+package anexia
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// planHash identifies the plan changes a record was created by
+func planHash(changes *plan.Changes) string {
+	content, err := json.Marshal(changes)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberRecord adds a created record to the state store, if one is configured. Failing to do so is only
+// logged, as the record already exists at Anexia.
+func (p *Provider) rememberRecord(record *anxcloudDns.Record, ep *endpoint.Endpoint, hash string) {
+	if p.state == nil {
+		return
+	}
+	if record.Identifier == "" {
+		// happens in dry run mode, as the record is not created
+		log.Debugf("not adding record %s of zone %s to the state, it has no identifier", record.Name, record.ZoneName)
+		return
+	}
+	err := p.state.Put(state.Entry{
+		RecordID:  record.Identifier,
+		ZoneName:  record.ZoneName,
+		Name:      record.Name,
+		Type:      record.Type,
+		RData:     record.RData,
+		TTL:       record.TTL,
+		Endpoint:  ep,
+		CreatedAt: time.Now().UTC(),
+		PlanHash:  hash,
+	})
+	if err != nil {
+		log.Errorf("failed to add record %s to the state: %v", record.Identifier, err)
+	}
+}
+
+// forgetRecord removes a deleted record from the state store, if one is configured
+func (p *Provider) forgetRecord(record *anxcloudDns.Record) {
+	if p.state == nil || record.Identifier == "" {
+		return
+	}
+	if err := p.state.Delete(record.Identifier); err != nil && !errors.Is(err, state.ErrNotFound) {
+		log.Errorf("failed to remove record %s from the state: %v", record.Identifier, err)
+	}
+}
+
+// Close releases the resources held by the provider
+func (p *Provider) Close() error {
+	if p.state == nil {
+		return nil
+	}
+	return p.state.Close()
+}
@@ -0,0 +1,166 @@
+package anexia
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/yaml"
+)
+
+// ttlBounds holds the default TTL for endpoints without TTL and the bounds of the TTL, zero values are not set
+type ttlBounds struct {
+	Default int64 `json:"default,omitempty"`
+	Min     int64 `json:"min,omitempty"`
+	Max     int64 `json:"max,omitempty"`
+}
+
+// ttlRule holds bounds for all record types and bounds for single record types, which take precedence
+type ttlRule struct {
+	ttlBounds
+	RecordTypes map[string]ttlBounds `json:"recordTypes,omitempty"`
+}
+
+// ttlPolicy holds the global TTL rule and rules per zone. For a record the most specific setting wins,
+// the order is zone and record type, zone, record type and global.
+type ttlPolicy struct {
+	ttlRule
+	Zones map[string]ttlRule `json:"zones,omitempty"`
+
+	zones *zoneTrie
+}
+
+// loadTTLPolicy reads the TTL policy from a YAML or JSON file
+func loadTTLPolicy(path string) (*ttlPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TTL policy: %w", err)
+	}
+	policy := &ttlPolicy{}
+	if err := yaml.UnmarshalStrict(content, policy); err != nil {
+		return nil, fmt.Errorf("failed to decode TTL policy: %w", err)
+	}
+	if err := policy.init(); err != nil {
+		return nil, fmt.Errorf("invalid TTL policy: %w", err)
+	}
+	return policy, nil
+}
+
+// init validates the policy and builds the lookup of the zone rules
+func (p *ttlPolicy) init() error {
+	if err := p.ttlRule.validate("global"); err != nil {
+		return err
+	}
+	p.RecordTypes = upperCaseKeys(p.RecordTypes)
+	zones := make([]*anxcloudDns.Zone, 0, len(p.Zones))
+	rules := make(map[string]ttlRule, len(p.Zones))
+	for zoneName, rule := range p.Zones {
+		if err := rule.validate("zone " + zoneName); err != nil {
+			return err
+		}
+		asciiName, err := toASCIIName(zoneName)
+		if err != nil {
+			return err
+		}
+		zones = append(zones, &anxcloudDns.Zone{Name: asciiName})
+		rule.RecordTypes = upperCaseKeys(rule.RecordTypes)
+		rules[asciiName] = rule
+	}
+	p.Zones = rules
+	p.zones = newZoneTrie(zones)
+	return nil
+}
+
+// upperCaseKeys allows record types to be configured in any case
+func upperCaseKeys(recordTypes map[string]ttlBounds) map[string]ttlBounds {
+	result := make(map[string]ttlBounds, len(recordTypes))
+	for recordType, bounds := range recordTypes {
+		result[strings.ToUpper(recordType)] = bounds
+	}
+	return result
+}
+
+func (r ttlRule) validate(scope string) error {
+	if err := r.ttlBounds.validate(scope); err != nil {
+		return err
+	}
+	for recordType, bounds := range r.RecordTypes {
+		if err := bounds.validate(scope + " record type " + recordType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b ttlBounds) validate(scope string) error {
+	if b.Default < 0 || b.Min < 0 || b.Max < 0 {
+		return fmt.Errorf("%s: TTLs must not be negative", scope)
+	}
+	if b.Min > 0 && b.Max > 0 && b.Min > b.Max {
+		return fmt.Errorf("%s: min %d is greater than max %d", scope, b.Min, b.Max)
+	}
+	if b.Default > 0 && (b.Default < b.Min || (b.Max > 0 && b.Default > b.Max)) {
+		return fmt.Errorf("%s: default %d is out of the bounds", scope, b.Default)
+	}
+	return nil
+}
+
+// bounds resolves the bounds for a record type at a domain name
+func (p *ttlPolicy) bounds(dnsName, recordType string) ttlBounds {
+	recordType = strings.ToUpper(recordType)
+	bounds := p.ttlBounds.overlay(p.RecordTypes[recordType])
+	if asciiName, err := toASCIIName(dnsName); err == nil {
+		if zone := p.zones.longestMatch(asciiName); zone != nil {
+			rule := p.Zones[zone.Name]
+			bounds = bounds.overlay(rule.ttlBounds).overlay(rule.RecordTypes[recordType])
+		}
+	}
+	return bounds
+}
+
+// overlay returns the bounds with the values which are set in other
+func (b ttlBounds) overlay(other ttlBounds) ttlBounds {
+	if other.Default > 0 {
+		b.Default = other.Default
+	}
+	if other.Min > 0 {
+		b.Min = other.Min
+	}
+	if other.Max > 0 {
+		b.Max = other.Max
+	}
+	return b
+}
+
+// adjust sets the default TTL if the TTL is not set and keeps it within the bounds.
+// It is applied to desired endpoints and records to create.
+func (p *ttlPolicy) adjust(dnsName, recordType string, ttl endpoint.TTL) endpoint.TTL {
+	if p == nil {
+		return ttl
+	}
+	bounds := p.bounds(dnsName, recordType)
+	if !ttl.IsConfigured() {
+		ttl = endpoint.TTL(bounds.Default)
+	}
+	if !ttl.IsConfigured() {
+		return ttl
+	}
+	if bounds.Min > 0 && int64(ttl) < bounds.Min {
+		ttl = endpoint.TTL(bounds.Min)
+	}
+	if bounds.Max > 0 && int64(ttl) > bounds.Max {
+		ttl = endpoint.TTL(bounds.Max)
+	}
+	return ttl
+}
+
+// withDefault only sets the default TTL if the TTL is not set. It is applied to the records at Anexia, so records
+// with a TTL out of the bounds show up as changes and are corrected.
+func (p *ttlPolicy) withDefault(dnsName, recordType string, ttl endpoint.TTL) endpoint.TTL {
+	if p == nil || ttl.IsConfigured() {
+		return ttl
+	}
+	return endpoint.TTL(p.bounds(dnsName, recordType).Default)
+}
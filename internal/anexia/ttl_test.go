@@ -0,0 +1,130 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const testTTLPolicy = `
+default: 300
+min: 60
+max: 86400
+recordTypes:
+  txt:
+    default: 3600
+zones:
+  example.com:
+    min: 600
+    recordTypes:
+      MX:
+        default: 7200
+        max: 7200
+  bücher.de:
+    default: 900
+`
+
+func TestTTLPolicy(t *testing.T) {
+	policy, err := loadTTLPolicy(writeTestFile(t, "ttl.yaml", testTTLPolicy))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name                string
+		givenDNSName        string
+		givenType           string
+		givenTTL            endpoint.TTL
+		expectedAdjusted    endpoint.TTL
+		expectedWithDefault endpoint.TTL
+	}{
+		{name: "global default", givenDNSName: "a.other.com", givenType: "A", givenTTL: 0, expectedAdjusted: 300, expectedWithDefault: 300},
+		{name: "global bounds", givenDNSName: "a.other.com", givenType: "A", givenTTL: 30, expectedAdjusted: 60, expectedWithDefault: 30},
+		{name: "global maximum", givenDNSName: "a.other.com", givenType: "A", givenTTL: 100000, expectedAdjusted: 86400, expectedWithDefault: 100000},
+		{name: "TTL within the bounds", givenDNSName: "a.other.com", givenType: "A", givenTTL: 120, expectedAdjusted: 120, expectedWithDefault: 120},
+		{name: "record type default", givenDNSName: "a.other.com", givenType: "TXT", givenTTL: 0, expectedAdjusted: 3600, expectedWithDefault: 3600},
+		{name: "zone minimum raises the global default", givenDNSName: "www.example.com", givenType: "A", givenTTL: 0, expectedAdjusted: 600, expectedWithDefault: 300},
+		{name: "zone minimum", givenDNSName: "www.example.com", givenType: "A", givenTTL: 300, expectedAdjusted: 600, expectedWithDefault: 300},
+		{name: "zone and record type", givenDNSName: "example.com", givenType: "MX", givenTTL: 0, expectedAdjusted: 7200, expectedWithDefault: 7200},
+		{name: "zone and record type maximum", givenDNSName: "example.com", givenType: "MX", givenTTL: 86400, expectedAdjusted: 7200, expectedWithDefault: 86400},
+		{name: "global record type within a zone", givenDNSName: "www.example.com", givenType: "TXT", givenTTL: 0, expectedAdjusted: 3600, expectedWithDefault: 3600},
+		{name: "near miss of a zone", givenDNSName: "badexample.com", givenType: "A", givenTTL: 300, expectedAdjusted: 300, expectedWithDefault: 300},
+		{name: "internationalized zone", givenDNSName: "www.xn--bcher-kva.de", givenType: "A", givenTTL: 0, expectedAdjusted: 900, expectedWithDefault: 900},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAdjusted, policy.adjust(tc.givenDNSName, tc.givenType, tc.givenTTL))
+			assert.Equal(t, tc.expectedWithDefault, policy.withDefault(tc.givenDNSName, tc.givenType, tc.givenTTL))
+		})
+	}
+}
+
+func TestNoTTLPolicy(t *testing.T) {
+	var policy *ttlPolicy
+	assert.Equal(t, endpoint.TTL(0), policy.adjust("a.de", "A", 0))
+	assert.Equal(t, endpoint.TTL(30), policy.withDefault("a.de", "A", 30))
+}
+
+func TestLoadInvalidTTLPolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenPolicy   string
+		expectedError string
+	}{
+		{name: "min greater than max", givenPolicy: "min: 600\nmax: 60\n", expectedError: "invalid TTL policy: global: min 600 is greater than max 60"},
+		{name: "default out of bounds", givenPolicy: "zones:\n  a.de:\n    default: 30\n    min: 60\n", expectedError: "invalid TTL policy: zone a.de: default 30 is out of the bounds"},
+		{name: "negative TTL", givenPolicy: "recordTypes:\n  A:\n    max: -1\n", expectedError: "invalid TTL policy: global record type A: TTLs must not be negative"},
+		{name: "unknown field", givenPolicy: "defaultTTL: 300\n", expectedError: "failed to decode TTL policy"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTTLPolicy(writeTestFile(t, "ttl.yaml", tc.givenPolicy))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+}
+
+func TestTTLPolicyWithoutPhantomDiffs(t *testing.T) {
+	policy, err := loadTTLPolicy(writeTestFile(t, "ttl.yaml", testTTLPolicy))
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "example.com" }),
+	}
+	provider := &Provider{client: mockDNSClient, ttlPolicy: policy}
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1"),
+	})
+	require.NoError(t, err)
+	require.Len(t, desired, 1)
+	assert.Equal(t, endpoint.TTL(600), desired[0].RecordTTL)
+
+	// records created by the command line are adjusted as well
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "1.1.1.1")},
+	}))
+	require.Len(t, mockDNSClient.createdRecords["example.com"], 1)
+	assert.Equal(t, 600, mockDNSClient.createdRecords["example.com"][0].TTL)
+
+	// records without TTL at Anexia are reported with the default TTL
+	mockDNSClient.allRecords = []*anxcloudDns.Record{
+		{Name: "www", ZoneName: "example.com", Type: "A", RData: "1.1.1.1", TTL: 600},
+		{Name: "txt", ZoneName: "example.com", Type: "TXT", RData: "\"x\""},
+	}
+	current, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	ttls := make(map[string]endpoint.TTL)
+	for _, ep := range current {
+		ttls[ep.DNSName] = ep.RecordTTL
+		if ep.DNSName == desired[0].DNSName {
+			assert.False(t, endpointsAreDifferent(*desired[0], *ep))
+		}
+	}
+	assert.Equal(t, map[string]endpoint.TTL{"www.example.com": 600, "txt.example.com": 3600}, ttls)
+}
@@ -0,0 +1,72 @@
+package anexia
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTXTChunkLength is the maximum length of a single character string in a TXT record
+const maxTXTChunkLength = 255
+
+// encodeTXT turns a TXT value into the rdata written to Anexia: a sequence of quoted character strings of at most
+// 255 bytes each. Values which already are quoted character strings are decoded first, so they are not quoted twice.
+func encodeTXT(value string) string {
+	value = decodeTXT(value)
+	chunks := make([]string, 0, len(value)/maxTXTChunkLength+1)
+	for {
+		chunk := value
+		if len(chunk) > maxTXTChunkLength {
+			// do not split multi-byte characters, the chunks have to stay valid UTF-8
+			end := maxTXTChunkLength
+			for end > 0 && !utf8.RuneStart(value[end]) {
+				end--
+			}
+			if end == 0 {
+				end = maxTXTChunkLength
+			}
+			chunk = value[:end]
+		}
+		chunks = append(chunks, quoteTXTChunk(chunk))
+		value = value[len(chunk):]
+		if value == "" {
+			break
+		}
+	}
+	return strings.Join(chunks, " ")
+}
+
+// decodeTXT turns the rdata of a TXT record back into its value by joining the quoted character strings.
+// Unquoted rdata is returned as it is.
+func decodeTXT(rdata string) string {
+	if value, ok := unquoteTXT(rdata); ok {
+		return value
+	}
+	return rdata
+}
+
+// quoteTXT turns a plain TXT value into a single quoted character string
+func quoteTXT(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+// quoteTXTChunk quotes a single character string, quotes and backslashes are escaped, control characters are
+// written as decimal escapes. Other bytes including non-ASCII characters are kept as they are.
+func quoteTXTChunk(chunk string) string {
+	quoted := strings.Builder{}
+	quoted.WriteByte('"')
+	for i := 0; i < len(chunk); i++ {
+		c := chunk[i]
+		switch {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&quoted, "\\%03d", c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
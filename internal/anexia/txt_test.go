@@ -0,0 +1,125 @@
+package anexia
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestTXTRoundTrip(t *testing.T) {
+	dkimKey := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", 10)
+	testCases := []struct {
+		name          string
+		givenValue    string
+		expectedRData string
+		expectedValue string
+	}{
+		{
+			name:          "short value",
+			givenValue:    "v=spf1 -all",
+			expectedRData: `"v=spf1 -all"`,
+			expectedValue: "v=spf1 -all",
+		},
+		{
+			name:          "empty value",
+			givenValue:    "",
+			expectedRData: `""`,
+			expectedValue: "",
+		},
+		{
+			name:          "already quoted value",
+			givenValue:    `"heritage=external-dns,external-dns/owner=default"`,
+			expectedRData: `"heritage=external-dns,external-dns/owner=default"`,
+			expectedValue: "heritage=external-dns,external-dns/owner=default",
+		},
+		{
+			name:          "already chunked value",
+			givenValue:    `"abc" "def"`,
+			expectedRData: `"abcdef"`,
+			expectedValue: "abcdef",
+		},
+		{
+			name:          "embedded quotes and backslashes",
+			givenValue:    `say "hi" to C:\temp`,
+			expectedRData: `"say \"hi\" to C:\\temp"`,
+			expectedValue: `say "hi" to C:\temp`,
+		},
+		{
+			name:          "control characters",
+			givenValue:    "line1\nline2\ttab",
+			expectedRData: `"line1\010line2\009tab"`,
+			expectedValue: "line1\nline2\ttab",
+		},
+		{
+			name:          "non-ASCII characters",
+			givenValue:    "grüße aus wien",
+			expectedRData: `"grüße aus wien"`,
+			expectedValue: "grüße aus wien",
+		},
+		{
+			name:          "exactly one chunk",
+			givenValue:    strings.Repeat("a", 255),
+			expectedRData: `"` + strings.Repeat("a", 255) + `"`,
+			expectedValue: strings.Repeat("a", 255),
+		},
+		{
+			name:          "two chunks",
+			givenValue:    strings.Repeat("a", 256),
+			expectedRData: `"` + strings.Repeat("a", 255) + `" "a"`,
+			expectedValue: strings.Repeat("a", 256),
+		},
+		{
+			name:          "escapes do not count for the chunk length",
+			givenValue:    strings.Repeat(`"`, 256),
+			expectedRData: `"` + strings.Repeat(`\"`, 255) + `" "\""`,
+			expectedValue: strings.Repeat(`"`, 256),
+		},
+		{
+			name:          "multi-byte characters are not split",
+			givenValue:    strings.Repeat("a", 254) + "ü",
+			expectedRData: `"` + strings.Repeat("a", 254) + `" "ü"`,
+			expectedValue: strings.Repeat("a", 254) + "ü",
+		},
+		{
+			name:          "DKIM key",
+			givenValue:    dkimKey,
+			expectedRData: `"` + dkimKey[:255] + `" "` + dkimKey[255:] + `"`,
+			expectedValue: dkimKey,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rdata := encodeTXT(tc.givenValue)
+			assert.Equal(t, tc.expectedRData, rdata)
+			assert.Equal(t, tc.expectedValue, decodeTXT(rdata))
+			// encoding is idempotent
+			assert.Equal(t, rdata, encodeTXT(rdata))
+
+			// the rdata is valid in zone file syntax
+			rr, err := dns.NewRR(". IN TXT " + rdata)
+			require.NoError(t, err)
+			require.NotNil(t, rr)
+		})
+	}
+}
+
+func TestDecodeTXTUnquoted(t *testing.T) {
+	assert.Equal(t, "v=spf1 -all", decodeTXT("v=spf1 -all"))
+	assert.Equal(t, `"abc" def`, decodeTXT(`"abc" def`))
+}
+
+func TestTXTRecordsAreJoinedOnRead(t *testing.T) {
+	ep := recordToEndpoint(&anxcloudDns.Record{
+		Name:     "selector._domainkey",
+		ZoneName: "a.de",
+		Type:     endpoint.RecordTypeTXT,
+		RData:    `"v=DKIM1; " "p=abc"`,
+	})
+	assert.Equal(t, endpoint.Targets{"v=DKIM1; p=abc"}, ep.Targets)
+}
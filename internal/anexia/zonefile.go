@@ -0,0 +1,213 @@
+package anexia
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// zoneFileLine is a single resource record of a zone file, kept apart to be able to sort them
+type zoneFileLine struct {
+	owner      string
+	ttl        int
+	recordType string
+	rdata      string
+}
+
+func (l zoneFileLine) String() string {
+	ttl := ""
+	if l.ttl > 0 {
+		ttl = fmt.Sprintf("%d", l.ttl)
+	}
+	return fmt.Sprintf("%s\t%s\tIN\t%s\t%s", l.owner, ttl, l.recordType, l.rdata)
+}
+
+// ExportZones writes the given zones as RFC 1035 master files, all zones are exported if no zone names are given.
+// Zones and records are written in a stable order, so the diff of two exports only shows actual changes.
+func (p *Provider) ExportZones(ctx context.Context, w io.Writer, zoneNames ...string) error {
+	allZones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	zones, err := selectZones(allZones, zoneNames)
+	if err != nil {
+		return err
+	}
+
+	for i, zone := range zones {
+		records, err := p.client.GetZoneRecords(ctx, zone.Name)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if err := writeZoneFile(w, zone, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectZones returns the zones with the given names sorted by name, or all zones if no names are given
+func selectZones(allZones []*anxcloudDns.Zone, zoneNames []string) ([]*anxcloudDns.Zone, error) {
+	zonesByName := make(map[string]*anxcloudDns.Zone, len(allZones))
+	for _, zone := range allZones {
+		zonesByName[zone.Name] = zone
+	}
+
+	zones := make([]*anxcloudDns.Zone, 0, len(allZones))
+	if len(zoneNames) == 0 {
+		zones = append(zones, allZones...)
+	} else {
+		for _, zoneName := range zoneNames {
+			zone, ok := zonesByName[strings.TrimSuffix(zoneName, ".")]
+			if !ok {
+				return nil, fmt.Errorf("zone '%s' not found", zoneName)
+			}
+			zones = append(zones, zone)
+		}
+	}
+
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Name < zones[j].Name
+	})
+	return zones, nil
+}
+
+// writeZoneFile renders a single zone with its SOA record and all records of the zone
+func writeZoneFile(w io.Writer, zone *anxcloudDns.Zone, records []*anxcloudDns.Record) error {
+	origin := dns.Fqdn(zone.Name)
+
+	lines := make([]zoneFileLine, 0, len(records))
+	for _, record := range records {
+		// the SOA record is rendered from the zone itself
+		if strings.EqualFold(record.Type, "SOA") {
+			continue
+		}
+		lines = append(lines, recordToZoneFileLine(record))
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].owner != lines[j].owner {
+			// the apex comes first
+			if lines[i].owner == apexRecordName || lines[j].owner == apexRecordName {
+				return lines[i].owner == apexRecordName
+			}
+			return lines[i].owner < lines[j].owner
+		}
+		if lines[i].recordType != lines[j].recordType {
+			return lines[i].recordType < lines[j].recordType
+		}
+		return lines[i].rdata < lines[j].rdata
+	})
+
+	body := &bytes.Buffer{}
+	for _, line := range lines {
+		fmt.Fprintln(body, line.String())
+	}
+
+	header := &bytes.Buffer{}
+	fmt.Fprintf(header, "$ORIGIN %s\n", origin)
+	if zone.TTL > 0 {
+		fmt.Fprintf(header, "$TTL %d\n", zone.TTL)
+	}
+	soa := zoneFileLine{
+		owner:      apexRecordName,
+		ttl:        zone.TTL,
+		recordType: "SOA",
+		rdata: fmt.Sprintf("%s %s %d %d %d %d %d",
+			soaPrimaryNameserver(zone, records), soaMailbox(zone), zoneSerial(zone, records),
+			zone.Refresh, zone.Retry, zone.Expire, zone.TTL),
+	}
+	fmt.Fprintln(header, soa.String())
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+func recordToZoneFileLine(record *anxcloudDns.Record) zoneFileLine {
+	owner := record.Name
+	if isApexRecordName(owner) {
+		owner = apexRecordName
+	}
+	recordType := strings.ToUpper(record.Type)
+
+	rdata := record.RData
+	if recordType == endpoint.RecordTypeTXT {
+		rdata = encodeTXT(rdata)
+	}
+
+	// let the dns library render the rdata, this fully qualifies names and normalizes the formatting
+	rr, err := dns.NewRR(fmt.Sprintf(". IN %s %s", recordType, rdata))
+	if err != nil || rr == nil {
+		log.Warnf("exporting record %s of type %s in zone %s with unparsable rdata '%s' verbatim: %v",
+			owner, recordType, record.ZoneName, record.RData, err)
+	} else {
+		rdata = strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+
+	return zoneFileLine{
+		owner:      owner,
+		ttl:        record.TTL,
+		recordType: recordType,
+		rdata:      rdata,
+	}
+}
+
+// soaPrimaryNameserver returns the master nameserver of the zone, or the first apex NS record if it is not set
+func soaPrimaryNameserver(zone *anxcloudDns.Zone, records []*anxcloudDns.Record) string {
+	if zone.MasterNS != "" {
+		return dns.Fqdn(zone.MasterNS)
+	}
+	nameservers := make([]string, 0)
+	for _, record := range records {
+		if strings.EqualFold(record.Type, "NS") && isApexRecordName(record.Name) {
+			nameservers = append(nameservers, dns.Fqdn(record.RData))
+		}
+	}
+	if len(nameservers) == 0 {
+		return dns.Fqdn(zone.Name)
+	}
+	sort.Strings(nameservers)
+	return nameservers[0]
+}
+
+// soaMailbox converts the admin email address of the zone to the mailbox format of the SOA record
+func soaMailbox(zone *anxcloudDns.Zone) string {
+	local, domain, found := strings.Cut(zone.AdminEmail, "@")
+	if !found {
+		return "hostmaster." + dns.Fqdn(zone.Name)
+	}
+	return strings.ReplaceAll(local, ".", "\\.") + "." + dns.Fqdn(domain)
+}
+
+// zoneSerial returns the serial of the SOA record Anexia maintains for the zone, or 0 if there is none
+func zoneSerial(zone *anxcloudDns.Zone, records []*anxcloudDns.Record) uint32 {
+	for _, record := range records {
+		if !strings.EqualFold(record.Type, "SOA") || !isApexRecordName(record.Name) {
+			continue
+		}
+		rr, err := dns.NewRR(". IN SOA " + record.RData)
+		if soa, ok := rr.(*dns.SOA); err == nil && ok {
+			return soa.Serial
+		}
+		log.Warnf("exporting zone %s with serial 0, the SOA rdata '%s' is unparsable: %v", zone.Name, record.RData, err)
+		return 0
+	}
+	log.Warnf("exporting zone %s with serial 0, Anexia returned no SOA record", zone.Name)
+	return 0
+}
@@ -0,0 +1,113 @@
+package anexia
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+func TestExportZones(t *testing.T) {
+	ctx := context.Background()
+	zones := []*anxcloudDns.Zone{
+		{Name: "b.de", AdminEmail: "dns.admin@b.de", Refresh: 14400, Retry: 3600, Expire: 604800, TTL: 3600},
+		{Name: "a.de", MasterNS: "ns1.a.de", Refresh: 14400, Retry: 3600, Expire: 604800, TTL: 300},
+		{Name: "c.de", Refresh: 14400, Retry: 3600, Expire: 604800, TTL: 300},
+	}
+	zoneRecords := map[string][]*anxcloudDns.Record{
+		"a.de": {
+			{Name: "www", ZoneName: "a.de", Type: "CNAME", TTL: 300, RData: "a.de"},
+			{Name: "@", ZoneName: "a.de", Type: "A", TTL: 300, RData: "2.2.2.2"},
+			{Name: "", ZoneName: "a.de", Type: "A", TTL: 300, RData: "1.1.1.1"},
+			{Name: "", ZoneName: "a.de", Type: "SOA", TTL: 300, RData: "ns0.anx.io. hostmaster.anx.io. 2026101801 3600 600 86400 300"},
+			{Name: "txt", ZoneName: "a.de", Type: "TXT", RData: "hello \"world\""},
+			{Name: "mail", ZoneName: "a.de", Type: "MX", TTL: 600, RData: "10 mx.a.de"},
+		},
+		"c.de": {
+			{Name: "", ZoneName: "c.de", Type: "SOA", TTL: 300, RData: "invalid"},
+		},
+		"b.de": {
+			{Name: "", ZoneName: "b.de", Type: "NS", TTL: 3600, RData: "ns2.b.de"},
+			{Name: "", ZoneName: "b.de", Type: "NS", TTL: 3600, RData: "ns1.b.de."},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		whenZoneNames []string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:          "single zone",
+			whenZoneNames: []string{"a.de."},
+			expected: "$ORIGIN a.de.\n" +
+				"$TTL 300\n" +
+				"@\t300\tIN\tSOA\tns1.a.de. hostmaster.a.de. 2026101801 14400 3600 604800 300\n" +
+				"@\t300\tIN\tA\t1.1.1.1\n" +
+				"@\t300\tIN\tA\t2.2.2.2\n" +
+				"mail\t600\tIN\tMX\t10 mx.a.de.\n" +
+				"txt\t\tIN\tTXT\t\"hello \\\"world\\\"\"\n" +
+				"www\t300\tIN\tCNAME\ta.de.\n",
+		},
+		{
+			name: "all zones sorted by name",
+			expected: "$ORIGIN a.de.\n" +
+				"$TTL 300\n" +
+				"@\t300\tIN\tSOA\tns1.a.de. hostmaster.a.de. 2026101801 14400 3600 604800 300\n" +
+				"@\t300\tIN\tA\t1.1.1.1\n" +
+				"@\t300\tIN\tA\t2.2.2.2\n" +
+				"mail\t600\tIN\tMX\t10 mx.a.de.\n" +
+				"txt\t\tIN\tTXT\t\"hello \\\"world\\\"\"\n" +
+				"www\t300\tIN\tCNAME\ta.de.\n" +
+				"\n" +
+				"$ORIGIN b.de.\n" +
+				"$TTL 3600\n" +
+				"@\t3600\tIN\tSOA\tns1.b.de. dns\\.admin.b.de. 0 14400 3600 604800 3600\n" +
+				"@\t3600\tIN\tNS\tns1.b.de.\n" +
+				"@\t3600\tIN\tNS\tns2.b.de.\n" +
+				"\n" +
+				"$ORIGIN c.de.\n" +
+				"$TTL 300\n" +
+				"@\t300\tIN\tSOA\tc.de. hostmaster.c.de. 0 14400 3600 604800 300\n",
+		},
+		{
+			name:          "unparsable SOA record",
+			whenZoneNames: []string{"c.de"},
+			expected: "$ORIGIN c.de.\n" +
+				"$TTL 300\n" +
+				"@\t300\tIN\tSOA\tc.de. hostmaster.c.de. 0 14400 3600 604800 300\n",
+		},
+		{
+			name:          "unknown zone",
+			whenZoneNames: []string{"d.de"},
+			expectedError: "zone 'd.de' not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDNSClient := &mockDNSClient{
+				allZones:    zones,
+				zoneRecords: zoneRecords,
+			}
+			provider := &Provider{client: mockDNSClient}
+			out := &bytes.Buffer{}
+			err := provider.ExportZones(ctx, out, tc.whenZoneNames...)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+
+			// exporting the same records again has to produce the same output
+			again := &bytes.Buffer{}
+			require.NoError(t, provider.ExportZones(ctx, again, tc.whenZoneNames...))
+			assert.Equal(t, out.String(), again.String())
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+// ImportOptions control how a zone file is applied to a zone
+type ImportOptions struct {
+	// DryRun only computes the changes without applying them
+	DryRun bool
+	// NoDelete keeps records of the zone which are missing in the zone file
+	NoDelete bool
+}
+
+// ImportResult holds the changes an import made, or would make in dry run mode
+type ImportResult struct {
+	ZoneName  string
+	Create    []*anxcloudDns.Record
+	Delete    []*anxcloudDns.Record
+	Unchanged int
+}
+
+// WriteTo writes the changes in zone file format, prefixed with '+' for creates and '-' for deletes
+func (r *ImportResult) WriteTo(w io.Writer) (int64, error) {
+	lines := make([]string, 0, len(r.Delete)+len(r.Create))
+	for _, record := range r.Delete {
+		lines = append(lines, "-\t"+recordToZoneFileLine(record).String())
+	}
+	for _, record := range r.Create {
+		lines = append(lines, "+\t"+recordToZoneFileLine(record).String())
+	}
+	lines = append(lines, fmt.Sprintf("zone %s: %d to create, %d to delete, %d unchanged",
+		r.ZoneName, len(r.Create), len(r.Delete), r.Unchanged))
+
+	n, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return int64(n), err
+}
+
+// ImportZone reads an RFC 1035 zone file and changes the records of the zone to match it.
+// The whole file is parsed and validated before any change is made. The records are created before the old ones
+// are deleted, so a rejected record leaves the zone with additional rather than missing records. The SOA and the
+// apex NS records are managed by Anexia and are neither imported nor deleted. Created records are added to the
+// state store like the records created for external-dns.
+func (p *Provider) ImportZone(ctx context.Context, zoneName string, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	zoneName = strings.TrimSuffix(zoneName, ".")
+	zones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := selectZones(zones, []string{zoneName}); err != nil {
+		return nil, err
+	}
+
+	desired, err := parseZoneFile(zoneName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := p.client.GetZoneRecords(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := diffZoneRecords(zoneName, current, desired)
+	if opts.NoDelete {
+		result.Delete = nil
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, record := range result.Create {
+		if err := p.client.CreateRecord(ctx, zoneName, record); err != nil {
+			return nil, fmt.Errorf("the Anexia API rejected the %s record '%s' in zone %s: %w", record.Type, record.Name, zoneName, err)
+		}
+		p.rememberRecord(record, recordToEndpoint(record), "")
+	}
+	for _, record := range result.Delete {
+		if err := p.client.DeleteRecord(ctx, zoneName, record.Identifier); err != nil {
+			return nil, err
+		}
+		p.forgetRecord(record)
+		p.current.forget(record.Identifier)
+	}
+	return result, nil
+}
+
+// parseZoneFile parses the zone file into records of the given zone. The rdata is validated by the parser and the
+// record types and rdata are checked like the records created for external-dns.
+func parseZoneFile(zoneName string, r io.Reader) ([]*anxcloudDns.Record, error) {
+	origin := dns.Fqdn(zoneName)
+	parser := dns.NewZoneParser(r, origin, "")
+
+	records := make([]*anxcloudDns.Record, 0)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		header := rr.Header()
+		if !dns.IsSubDomain(origin, header.Name) {
+			return nil, fmt.Errorf("record %s is not part of zone %s", header.Name, zoneName)
+		}
+		recordType, ok := dns.TypeToString[header.Rrtype]
+		if !ok {
+			return nil, fmt.Errorf("record %s has unsupported type %d", header.Name, header.Rrtype)
+		}
+		record := &anxcloudDns.Record{
+			ZoneName: zoneName,
+			Name:     recordName(header.Name, origin),
+			Type:     recordType,
+			TTL:      int(header.Ttl),
+			RData:    strings.TrimPrefix(rr.String(), header.String()),
+		}
+		if isManagedByAnexia(record) {
+			log.Debugf("skipping %s record %s of zone file, it is managed by Anexia", record.Type, header.Name)
+			continue
+		}
+		if !isSupportedRecordType(record.Type) {
+			return nil, fmt.Errorf("record %s has unsupported type %s", header.Name, record.Type)
+		}
+		if err := validateRData(record.Type, record.RData); err != nil {
+			return nil, fmt.Errorf("invalid %s record %s: %w", record.Type, header.Name, err)
+		}
+		records = append(records, record)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("invalid zone file: %w", err)
+	}
+	return records, nil
+}
+
+// isManagedByAnexia reports whether the record is maintained by Anexia for the zone itself
+func isManagedByAnexia(record *anxcloudDns.Record) bool {
+	recordType := strings.ToUpper(record.Type)
+	return recordType == "SOA" || (isApexRecordName(record.Name) && recordType == "NS")
+}
+
+// diffZoneRecords computes the records to create and to delete to get from the current to the desired records.
+// Records are compared by their canonical rdata, so quoting and trailing dots of the zone file do not count as a
+// change, a changed TTL replaces the record. Immutable records are never deleted.
+func diffZoneRecords(zoneName string, current, desired []*anxcloudDns.Record) *ImportResult {
+	key := func(record *anxcloudDns.Record) string {
+		return fmt.Sprintf("%s %d %s %s", recordNameKey(zoneName, record.Name), record.TTL, strings.ToUpper(record.Type),
+			canonicalRData(record.Type, record.RData))
+	}
+
+	desiredKeys := make(map[string]bool, len(desired))
+	for _, record := range desired {
+		desiredKeys[key(record)] = true
+	}
+
+	result := &ImportResult{ZoneName: zoneName}
+	currentKeys := make(map[string]bool, len(current))
+	for _, record := range current {
+		if isManagedByAnexia(record) {
+			continue
+		}
+		k := key(record)
+		currentKeys[k] = true
+		if desiredKeys[k] {
+			result.Unchanged++
+		} else {
+			result.Delete = append(result.Delete, record)
+		}
+	}
+	for _, record := range desired {
+		k := key(record)
+		if !currentKeys[k] {
+			result.Create = append(result.Create, record)
+			// duplicates in the zone file are only created once
+			currentKeys[k] = true
+		}
+	}
+
+	result.Delete = withoutImmutable(result.Delete)
+	sortRecords(result.Create)
+	sortRecords(result.Delete)
+	return result
+}
+
+func sortRecords(records []*anxcloudDns.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return recordToZoneFileLine(records[i]).String() < recordToZoneFileLine(records[j]).String()
+	})
+}
@@ -0,0 +1,195 @@
+package anexia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+func TestImportZone(t *testing.T) {
+	ctx := context.Background()
+	zoneFile := `$ORIGIN a.de.
+$TTL 300
+@	IN	SOA	ns1.other.net. hostmaster.a.de. 1 14400 3600 604800 300
+@	IN	NS	ns1.other.net.
+@	IN	A	1.1.1.1
+www	IN	CNAME	a.de.
+txt	600	IN	TXT	"hello world"
+`
+	givenRecords := func() []*anxcloudDns.Record {
+		return []*anxcloudDns.Record{
+			{Identifier: "ns", Name: "", ZoneName: "a.de", Type: "NS", TTL: 300, RData: "acns01.xaas.systems."},
+			{Identifier: "apex", Name: "", ZoneName: "a.de", Type: "A", TTL: 300, RData: "1.1.1.1"},
+			{Identifier: "www", Name: "www", ZoneName: "a.de", Type: "CNAME", TTL: 300, RData: "old.a.de"},
+			{Identifier: "txt", Name: "txt", ZoneName: "a.de", Type: "TXT", TTL: 300, RData: "\"hello world\""},
+		}
+	}
+
+	testCases := []struct {
+		name            string
+		whenZoneName    string
+		whenZoneFile    string
+		whenOptions     ImportOptions
+		expectedCreated []string
+		expectedDeleted []string
+		expectedOutput  string
+		expectedError   string
+	}{
+		{
+			name:            "import creates and deletes",
+			whenZoneName:    "a.de",
+			whenZoneFile:    zoneFile,
+			expectedCreated: []string{"txt 600 TXT \"hello world\"", "www 300 CNAME a.de."},
+			expectedDeleted: []string{"txt", "www"},
+			expectedOutput: "-\ttxt\t300\tIN\tTXT\t\"hello world\"\n" +
+				"-\twww\t300\tIN\tCNAME\told.a.de.\n" +
+				"+\ttxt\t600\tIN\tTXT\t\"hello world\"\n" +
+				"+\twww\t300\tIN\tCNAME\ta.de.\n" +
+				"zone a.de: 2 to create, 2 to delete, 1 unchanged\n",
+		},
+		{
+			name:            "dry run changes nothing",
+			whenZoneName:    "a.de.",
+			whenZoneFile:    zoneFile,
+			whenOptions:     ImportOptions{DryRun: true},
+			expectedCreated: nil,
+			expectedDeleted: nil,
+			expectedOutput: "-\ttxt\t300\tIN\tTXT\t\"hello world\"\n" +
+				"-\twww\t300\tIN\tCNAME\told.a.de.\n" +
+				"+\ttxt\t600\tIN\tTXT\t\"hello world\"\n" +
+				"+\twww\t300\tIN\tCNAME\ta.de.\n" +
+				"zone a.de: 2 to create, 2 to delete, 1 unchanged\n",
+		},
+		{
+			name:            "no delete keeps records missing in the zone file",
+			whenZoneName:    "a.de",
+			whenZoneFile:    "$ORIGIN a.de.\nnew 300 IN A 2.2.2.2\n",
+			whenOptions:     ImportOptions{NoDelete: true},
+			expectedCreated: []string{"new 300 A 2.2.2.2"},
+			expectedOutput: "+\tnew\t300\tIN\tA\t2.2.2.2\n" +
+				"zone a.de: 1 to create, 0 to delete, 0 unchanged\n",
+		},
+		{
+			name:          "invalid rdata fails before any change",
+			whenZoneName:  "a.de",
+			whenZoneFile:  "$ORIGIN a.de.\nnew 300 IN A 2.2.2.2\nbad 300 IN AAAA 1.2.3.4\n",
+			expectedError: "invalid zone file: dns: bad AAAA AAAA: \"1.2.3.4\" at line: 3:23",
+		},
+		{
+			name:          "unsupported record type fails before any change",
+			whenZoneName:  "a.de",
+			whenZoneFile:  "$ORIGIN a.de.\nnew 300 IN A 2.2.2.2\nloc 300 IN LOC 52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m\n",
+			expectedError: "record loc.a.de. has unsupported type LOC",
+		},
+		{
+			name:          "rdata the Anexia API would reject fails before any change",
+			whenZoneName:  "a.de",
+			whenZoneFile:  "$ORIGIN a.de.\nnew 300 IN A 2.2.2.2\n_443._tcp 300 IN TLSA 4 1 1 d2abde240d7cd3ee6b4b28c54df034b97983a1d16e8a410e4561cb106618e971\n",
+			expectedError: "invalid TLSA record _443._tcp.a.de.: invalid TLSA certificate usage 4",
+		},
+		{
+			name:          "record outside of the zone",
+			whenZoneName:  "a.de",
+			whenZoneFile:  "www.b.de. 300 IN A 2.2.2.2\n",
+			expectedError: "record www.b.de. is not part of zone a.de",
+		},
+		{
+			name:          "unknown zone",
+			whenZoneName:  "b.de",
+			whenZoneFile:  zoneFile,
+			expectedError: "zone 'b.de' not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDNSClient := &mockDNSClient{
+				allZones:    createZoneSlice(1, func(_ int) string { return "a.de" }),
+				zoneRecords: map[string][]*anxcloudDns.Record{"a.de": givenRecords()},
+			}
+			provider := &Provider{client: mockDNSClient}
+			result, err := provider.ImportZone(ctx, tc.whenZoneName, strings.NewReader(tc.whenZoneFile), tc.whenOptions)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				assert.Empty(t, mockDNSClient.createdRecords)
+				assert.Empty(t, mockDNSClient.deletedRecords)
+				return
+			}
+			require.NoError(t, err)
+
+			created := make([]string, 0)
+			for _, record := range mockDNSClient.createdRecords["a.de"] {
+				created = append(created, strings.Join([]string{record.Name, fmt.Sprintf("%d", record.TTL), record.Type, record.RData}, " "))
+			}
+			assert.ElementsMatch(t, tc.expectedCreated, created)
+			assert.ElementsMatch(t, tc.expectedDeleted, mockDNSClient.deletedRecords["a.de"])
+
+			out := &bytes.Buffer{}
+			_, err = result.WriteTo(out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOutput, out.String())
+		})
+	}
+}
+
+func TestImportZoneCreatesBeforeDeleting(t *testing.T) {
+	zoneFile := "$ORIGIN a.de.\nwww 300 IN A 2.2.2.2\n"
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(1, func(_ int) string { return "a.de" }),
+		zoneRecords: map[string][]*anxcloudDns.Record{"a.de": {
+			{Identifier: "old", Name: "www", ZoneName: "a.de", Type: "A", TTL: 300, RData: "1.1.1.1"},
+		}},
+		createError: errors.New("rejected"),
+	}
+	provider := &Provider{client: mockDNSClient}
+	_, err := provider.ImportZone(context.Background(), "a.de", strings.NewReader(zoneFile), ImportOptions{})
+	require.EqualError(t, err, "the Anexia API rejected the A record 'www' in zone a.de: rejected")
+	assert.Empty(t, mockDNSClient.deletedRecords, "the old records are kept if a record is rejected")
+
+	store := state.NewMemoryStore()
+	mockDNSClient.createError = nil
+	provider.state = store
+	_, err = provider.ImportZone(context.Background(), "a.de", strings.NewReader(zoneFile), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old"}, mockDNSClient.deletedRecords["a.de"])
+	entries, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "imported records are added to the state")
+	assert.Equal(t, "2.2.2.2", entries[0].RData)
+	assert.Equal(t, "www.a.de", entries[0].Endpoint.DNSName)
+}
+
+func TestDiffZoneRecords(t *testing.T) {
+	desired, err := parseZoneFile("a.de", strings.NewReader(`$ORIGIN a.de.
+$TTL 300
+www	IN	CNAME	Target.a.de.
+txt	IN	TXT	"v=spf1 -all"
+v6	IN	AAAA	2001:db8::1
+mx	IN	MX	10 mail.a.de.
+caa	IN	CAA	0 issue "letsencrypt.org"
+`))
+	require.NoError(t, err)
+	current := []*anxcloudDns.Record{
+		{Identifier: "www", Name: "WWW", ZoneName: "a.de", Type: "CNAME", TTL: 300, RData: "target.a.de"},
+		{Identifier: "txt", Name: "txt", ZoneName: "a.de", Type: "TXT", TTL: 300, RData: "v=spf1 -all"},
+		{Identifier: "v6", Name: "v6", ZoneName: "a.de", Type: "AAAA", TTL: 300, RData: "2001:DB8:0::1"},
+		{Identifier: "mx", Name: "mx", ZoneName: "a.de", Type: "MX", TTL: 300, RData: "10 mail.a.de"},
+		{Identifier: "caa", Name: "caa", ZoneName: "a.de", Type: "CAA", TTL: 300, RData: "0 issue letsencrypt.org"},
+		{Identifier: "fixed", Name: "fixed", ZoneName: "a.de", Type: "A", TTL: 300, RData: "192.0.2.1", Immutable: true},
+		{Identifier: "old", Name: "old", ZoneName: "a.de", Type: "A", TTL: 300, RData: "192.0.2.2"},
+	}
+
+	result := diffZoneRecords("a.de", current, desired)
+	assert.Empty(t, result.Create, "records which only differ in their format are not created again")
+	require.Len(t, result.Delete, 1, "immutable records are not deleted")
+	assert.Equal(t, "old", result.Delete[0].Identifier)
+	assert.Equal(t, 5, result.Unchanged)
+}
@@ -0,0 +1,170 @@
+package anexia
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// zoneMappingRule publishes the names matching the pattern in the zone. The pattern is either a name or a wildcard
+// '*.<suffix>' matching all names below the suffix.
+type zoneMappingRule struct {
+	Pattern string `json:"pattern"`
+	Zone    string `json:"zone"`
+
+	wildcard bool
+	name     string
+	zone     string
+}
+
+// zoneMapping overrides the automatic zone selection. A rule for the exact name wins over wildcards, of the
+// wildcards the one with the longest suffix wins.
+type zoneMapping struct {
+	rules []*zoneMappingRule
+}
+
+// ZoneResolution explains in which zone a name is published
+type ZoneResolution struct {
+	Name          string   `json:"name"`
+	PublishedName string   `json:"publishedName"`
+	Zone          string   `json:"zone,omitempty"`
+	Pattern       string   `json:"pattern,omitempty"`
+	Reason        string   `json:"reason"`
+	MatchingZones []string `json:"matchingZones"`
+	DeleteZones   []string `json:"deleteZones"`
+}
+
+// loadZoneMapping reads the zone mapping from a YAML or JSON file
+func loadZoneMapping(path string) (*zoneMapping, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zone mapping: %w", err)
+	}
+	rules := make([]*zoneMappingRule, 0)
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode zone mapping: %w", err)
+	}
+	mapping := &zoneMapping{rules: rules}
+	if err := mapping.init(); err != nil {
+		return nil, fmt.Errorf("invalid zone mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// init validates the rules, the names matching a pattern have to belong to its zone
+func (m *zoneMapping) init() error {
+	patterns := make(map[string]bool, len(m.rules))
+	for _, rule := range m.rules {
+		pattern := strings.TrimSpace(rule.Pattern)
+		rule.wildcard = strings.HasPrefix(pattern, "*.")
+		name, err := toASCIIName(strings.TrimPrefix(pattern, "*."))
+		if err != nil || name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("invalid pattern '%s'", rule.Pattern)
+		}
+		rule.name = name
+		if rule.zone, err = toASCIIName(rule.Zone); err != nil || rule.zone == "" {
+			return fmt.Errorf("invalid zone '%s' of pattern %s", rule.Zone, rule.Pattern)
+		}
+		if !isSubdomainOf(rule.name, rule.zone) {
+			return fmt.Errorf("the names matching %s do not belong to the zone %s", rule.Pattern, rule.Zone)
+		}
+		key := rule.String()
+		if patterns[key] {
+			return fmt.Errorf("duplicate pattern %s", rule.Pattern)
+		}
+		patterns[key] = true
+	}
+	return nil
+}
+
+// lookup returns the rule of the ASCII name, or nil if no pattern matches
+func (m *zoneMapping) lookup(asciiName string) *zoneMappingRule {
+	if m == nil {
+		return nil
+	}
+	asciiName = normalizeDomainName(asciiName)
+	var match *zoneMappingRule
+	for _, rule := range m.rules {
+		switch {
+		case !rule.wildcard && rule.name == asciiName:
+			return rule
+		case rule.wildcard && strings.HasSuffix(asciiName, "."+rule.name):
+			if match == nil || len(rule.name) > len(match.name) {
+				match = rule
+			}
+		}
+	}
+	return match
+}
+
+func (r *zoneMappingRule) String() string {
+	if r.wildcard {
+		return "*." + r.name
+	}
+	return r.name
+}
+
+// resolveZone returns the zone the ASCII name at Anexia is published in and the zones records of the name are
+// deleted from. Without a matching pattern, records are created in the most specific zone and deleted from all
+// zones of the name, so records created before a more specific zone existed are cleaned up as well.
+func (p *Provider) resolveZone(zones *zoneTrie, asciiName string) (*anxcloudDns.Zone, *ZoneResolution) {
+	matching := zones.match(asciiName)
+	resolution := &ZoneResolution{
+		PublishedName: asciiName,
+		MatchingZones: namesOfZones(matching),
+		DeleteZones:   []string{},
+	}
+	if rule := p.zoneMapping.lookup(asciiName); rule != nil {
+		resolution.Pattern = rule.String()
+		for _, zone := range matching {
+			if normalizeDomainName(zone.Name) == rule.zone {
+				resolution.Zone = zone.Name
+				resolution.DeleteZones = []string{zone.Name}
+				resolution.Reason = fmt.Sprintf("the pattern %s maps the name to the zone %s", rule.Pattern, rule.Zone)
+				return zone, resolution
+			}
+		}
+		resolution.Reason = fmt.Sprintf("the pattern %s maps the name to the zone %s, which does not exist", rule.Pattern, rule.Zone)
+		return nil, resolution
+	}
+	if len(matching) == 0 {
+		resolution.Reason = "no zone found for the name"
+		return nil, resolution
+	}
+	resolution.Zone = matching[0].Name
+	resolution.DeleteZones = resolution.MatchingZones
+	if len(matching) == 1 {
+		resolution.Reason = "the name belongs to one zone"
+	} else {
+		resolution.Reason = "no pattern matches the name, the most specific zone is used"
+	}
+	return matching[0], resolution
+}
+
+// ResolveZone explains in which zone records of the name are created and from which zones they are deleted. Invalid
+// names fail with an error wrapping ErrInvalidName.
+func (p *Provider) ResolveZone(ctx context.Context, name string) (any, error) {
+	asciiName, err := toASCIIName(p.publishedName(name))
+	if err != nil {
+		return nil, err
+	}
+	allZones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, resolution := p.resolveZone(newZoneTrie(allZones), asciiName)
+	resolution.Name = name
+	return resolution, nil
+}
+
+func namesOfZones(zones []*anxcloudDns.Zone) []string {
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zone.Name)
+	}
+	return names
+}
@@ -0,0 +1,185 @@
+package anexia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const testZoneMapping = `
+- pattern: '*.dev.example.com'
+  zone: example.com
+- pattern: api.dev.example.com
+  zone: dev.example.com
+- pattern: '*.eu.dev.example.com'
+  zone: dev.example.com
+- pattern: '*.missing.example.com'
+  zone: missing.example.com
+`
+
+func TestLoadZoneMapping(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenMapping  string
+		expectedError string
+	}{
+		{name: "valid mapping", givenMapping: testZoneMapping},
+		{
+			name:          "unknown field",
+			givenMapping:  "- pattern: a.de\n  target: de\n",
+			expectedError: `failed to decode zone mapping: error unmarshaling JSON: while decoding JSON: json: unknown field "target"`,
+		},
+		{
+			name:          "wildcard inside the pattern",
+			givenMapping:  "- pattern: 'a.*.de'\n  zone: de\n",
+			expectedError: "invalid zone mapping: invalid pattern 'a.*.de'",
+		},
+		{
+			name:          "missing zone",
+			givenMapping:  "- pattern: a.de\n",
+			expectedError: "invalid zone mapping: invalid zone '' of pattern a.de",
+		},
+		{
+			name:          "names outside of the zone",
+			givenMapping:  "- pattern: '*.a.de'\n  zone: b.de\n",
+			expectedError: "invalid zone mapping: the names matching *.a.de do not belong to the zone b.de",
+		},
+		{
+			name:          "duplicate pattern",
+			givenMapping:  "- pattern: '*.a.de'\n  zone: de\n- pattern: '*.A.de.'\n  zone: a.de\n",
+			expectedError: "invalid zone mapping: duplicate pattern *.A.de.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadZoneMapping(writeTestFile(t, "zones.yaml", tc.givenMapping))
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestResolveZone(t *testing.T) {
+	mapping, err := loadZoneMapping(writeTestFile(t, "zones.yaml", testZoneMapping))
+	require.NoError(t, err)
+	provider := &Provider{
+		client: &mockDNSClient{allZones: createZoneSlice(3, func(i int) string {
+			return []string{"example.com", "dev.example.com", "other.com"}[i]
+		})},
+		zoneMapping: mapping,
+	}
+
+	testCases := []struct {
+		name            string
+		givenName       string
+		expectedZone    string
+		expectedPattern string
+		expectedDelete  []string
+		expectedReason  string
+	}{
+		{
+			name:            "wildcard pattern",
+			givenName:       "app.dev.example.com",
+			expectedZone:    "example.com",
+			expectedPattern: "*.dev.example.com",
+			expectedDelete:  []string{"example.com"},
+			expectedReason:  "the pattern *.dev.example.com maps the name to the zone example.com",
+		},
+		{
+			name:            "exact pattern wins over wildcards",
+			givenName:       "API.dev.example.com.",
+			expectedZone:    "dev.example.com",
+			expectedPattern: "api.dev.example.com",
+			expectedDelete:  []string{"dev.example.com"},
+			expectedReason:  "the pattern api.dev.example.com maps the name to the zone dev.example.com",
+		},
+		{
+			name:            "longest wildcard wins",
+			givenName:       "app.eu.dev.example.com",
+			expectedZone:    "dev.example.com",
+			expectedPattern: "*.eu.dev.example.com",
+			expectedDelete:  []string{"dev.example.com"},
+			expectedReason:  "the pattern *.eu.dev.example.com maps the name to the zone dev.example.com",
+		},
+		{
+			name:           "wildcard does not match the suffix itself",
+			givenName:      "dev.example.com",
+			expectedZone:   "dev.example.com",
+			expectedDelete: []string{"dev.example.com", "example.com"},
+			expectedReason: "no pattern matches the name, the most specific zone is used",
+		},
+		{
+			name:           "single zone",
+			givenName:      "www.other.com",
+			expectedZone:   "other.com",
+			expectedDelete: []string{"other.com"},
+			expectedReason: "the name belongs to one zone",
+		},
+		{
+			name:            "mapped zone does not exist",
+			givenName:       "app.missing.example.com",
+			expectedPattern: "*.missing.example.com",
+			expectedDelete:  []string{},
+			expectedReason:  "the pattern *.missing.example.com maps the name to the zone missing.example.com, which does not exist",
+		},
+		{
+			name:           "no zone",
+			givenName:      "www.unknown.org",
+			expectedDelete: []string{},
+			expectedReason: "no zone found for the name",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := provider.ResolveZone(context.Background(), tc.givenName)
+			require.NoError(t, err)
+			resolution := result.(*ZoneResolution)
+			assert.Equal(t, tc.givenName, resolution.Name)
+			assert.Equal(t, tc.expectedZone, resolution.Zone)
+			assert.Equal(t, tc.expectedPattern, resolution.Pattern)
+			assert.Equal(t, tc.expectedDelete, resolution.DeleteZones)
+			assert.Equal(t, tc.expectedReason, resolution.Reason)
+		})
+	}
+
+	_, err = provider.ResolveZone(context.Background(), "-app.example.com")
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestApplyChangesZoneMapping(t *testing.T) {
+	mapping, err := loadZoneMapping(writeTestFile(t, "zones.yaml", testZoneMapping))
+	require.NoError(t, err)
+	mockDNSClient := &mockDNSClient{
+		allZones: createZoneSlice(2, func(i int) string {
+			return []string{"example.com", "dev.example.com"}[i]
+		}),
+		zoneRecords: map[string][]*anxcloudDns.Record{
+			"example.com":     {{Identifier: "parent", ZoneName: "example.com", Name: "old.dev", Type: "A", RData: "192.0.2.1"}},
+			"dev.example.com": {{Identifier: "child", ZoneName: "dev.example.com", Name: "old", Type: "A", RData: "192.0.2.1"}},
+		},
+	}
+	provider := &Provider{client: mockDNSClient, zoneMapping: mapping}
+
+	require.NoError(t, provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("new.dev.example.com", "A", 300, "192.0.2.2"),
+			endpoint.NewEndpointWithTTL("app.missing.example.com", "A", 300, "192.0.2.3"),
+		},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.dev.example.com", "A", 300, "192.0.2.1")},
+	}))
+
+	require.Len(t, mockDNSClient.createdRecords["example.com"], 1, "unmapped zones are not used as fallback")
+	assert.Equal(t, "new.dev", mockDNSClient.createdRecords["example.com"][0].Name)
+	assert.Empty(t, mockDNSClient.createdRecords["dev.example.com"])
+	assert.Equal(t, map[string][]string{"example.com": {"parent"}}, mockDNSClient.deletedRecords)
+}
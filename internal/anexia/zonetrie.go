@@ -0,0 +1,83 @@
+package anexia
+
+import (
+	"strings"
+
+	anxcloudDns "go.anx.io/go-anxcloud/pkg/apis/clouddns/v1"
+)
+
+// zoneTrie resolves domain names to zones on label boundaries. It is keyed by the labels of the zone names
+// from right to left, so a lookup only walks the labels of the domain name.
+type zoneTrie struct {
+	root *zoneTrieNode
+}
+
+type zoneTrieNode struct {
+	children map[string]*zoneTrieNode
+	zone     *anxcloudDns.Zone
+}
+
+func newZoneTrie(zones []*anxcloudDns.Zone) *zoneTrie {
+	t := &zoneTrie{root: &zoneTrieNode{children: make(map[string]*zoneTrieNode)}}
+	for _, zone := range zones {
+		t.insert(zone)
+	}
+	return t
+}
+
+func (t *zoneTrie) insert(zone *anxcloudDns.Zone) {
+	node := t.root
+	for _, label := range reversedLabels(zone.Name) {
+		child, ok := node.children[label]
+		if !ok {
+			child = &zoneTrieNode{children: make(map[string]*zoneTrieNode)}
+			node.children[label] = child
+		}
+		node = child
+	}
+	node.zone = zone
+}
+
+// match returns all zones the domain name belongs to, the most specific zone first
+func (t *zoneTrie) match(domainName string) []*anxcloudDns.Zone {
+	zones := make([]*anxcloudDns.Zone, 0)
+	node := t.root
+	for _, label := range reversedLabels(domainName) {
+		child, ok := node.children[label]
+		if !ok {
+			break
+		}
+		node = child
+		if node.zone != nil {
+			zones = append([]*anxcloudDns.Zone{node.zone}, zones...)
+		}
+	}
+	return zones
+}
+
+// longestMatch returns the most specific zone of the domain name, or nil if it belongs to no zone
+func (t *zoneTrie) longestMatch(domainName string) *anxcloudDns.Zone {
+	zones := t.match(domainName)
+	if len(zones) == 0 {
+		return nil
+	}
+	return zones[0]
+}
+
+// normalizeDomainName lower cases the name and removes the trailing dot of a fully qualified name
+func normalizeDomainName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// reversedLabels returns the labels of the normalized name from right to left
+func reversedLabels(name string) []string {
+	name = normalizeDomainName(name)
+	if name == "" {
+		return nil
+	}
+	labels := strings.Split(name, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
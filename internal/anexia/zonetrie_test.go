@@ -0,0 +1,108 @@
+package anexia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneTrie(t *testing.T) {
+	zones := createZoneSlice(6, func(i int) string {
+		return []string{"example.com", "dev.example.com", "other.com", "Example.org.", "a.b.c.example.com", "de"}[i]
+	})
+	trie := newZoneTrie(zones)
+
+	testCases := []struct {
+		name          string
+		domainName    string
+		expectedZones []string
+	}{
+		{
+			name:          "apex of a zone",
+			domainName:    "example.com",
+			expectedZones: []string{"example.com"},
+		},
+		{
+			name:          "record in a zone",
+			domainName:    "www.example.com",
+			expectedZones: []string{"example.com"},
+		},
+		{
+			name:          "nested zone comes first",
+			domainName:    "api.dev.example.com",
+			expectedZones: []string{"dev.example.com", "example.com"},
+		},
+		{
+			name:          "apex of a nested zone",
+			domainName:    "dev.example.com",
+			expectedZones: []string{"dev.example.com", "example.com"},
+		},
+		{
+			name:          "deeply nested zone skipping intermediate labels",
+			domainName:    "x.a.b.c.example.com",
+			expectedZones: []string{"a.b.c.example.com", "example.com"},
+		},
+		{
+			name:          "intermediate label without zone",
+			domainName:    "b.c.example.com",
+			expectedZones: []string{"example.com"},
+		},
+		{
+			name:          "near miss on the label boundary",
+			domainName:    "badexample.com",
+			expectedZones: []string{},
+		},
+		{
+			name:          "near miss of a nested zone",
+			domainName:    "www.notdev.example.com",
+			expectedZones: []string{"example.com"},
+		},
+		{
+			name:          "sibling zone",
+			domainName:    "www.other.com",
+			expectedZones: []string{"other.com"},
+		},
+		{
+			name:          "parent of a zone",
+			domainName:    "com",
+			expectedZones: []string{},
+		},
+		{
+			name:          "different case and trailing dot",
+			domainName:    "WWW.Example.COM.",
+			expectedZones: []string{"example.com"},
+		},
+		{
+			name:          "zone with different case and trailing dot",
+			domainName:    "www.example.org",
+			expectedZones: []string{"Example.org."},
+		},
+		{
+			name:          "top level zone",
+			domainName:    "a.de",
+			expectedZones: []string{"de"},
+		},
+		{
+			name:          "empty name",
+			domainName:    "",
+			expectedZones: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zoneNames := make([]string, 0)
+			for _, zone := range trie.match(tc.domainName) {
+				zoneNames = append(zoneNames, zone.Name)
+			}
+			assert.Equal(t, tc.expectedZones, zoneNames)
+
+			longest := trie.longestMatch(tc.domainName)
+			if len(tc.expectedZones) == 0 {
+				assert.Nil(t, longest)
+			} else {
+				assert.Equal(t, tc.expectedZones[0], longest.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+var (
+	recordsBucket   = []byte("records")
+	desiredBucket   = []byte("desired")
+	flattenedBucket = []byte("flattened")
+)
+
+// BoltStore is a Store which keeps the entries in a local BoltDB file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the BoltDB file at the given path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	// the timeout prevents blocking forever if another process holds the file lock
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(recordsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(desiredBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(flattenedBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize state file %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Put(entry Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordsBucket).Put([]byte(entry.RecordID), value)
+	})
+}
+
+func (s *BoltStore) Get(recordID string) (*Entry, error) {
+	var entry *Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(recordsBucket).Get([]byte(recordID))
+		if value == nil {
+			return ErrNotFound
+		}
+		entry = &Entry{}
+		return json.Unmarshal(value, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *BoltStore) Delete(recordID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordsBucket).Delete([]byte(recordID))
+	})
+}
+
+func (s *BoltStore) List() ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordsBucket).ForEach(func(_, value []byte) error {
+			entry := Entry{}
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *BoltStore) PutDesired(key string, ep *endpoint.Endpoint) error {
+	value, err := json.Marshal(ep)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(desiredBucket).Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) DeleteDesired(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(desiredBucket).Delete([]byte(key))
+	})
+}
+
+// ListDesired returns the endpoints in key order, as BoltDB iterates over the keys in byte order
+func (s *BoltStore) ListDesired() ([]*endpoint.Endpoint, error) {
+	endpoints := make([]*endpoint.Endpoint, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(desiredBucket).ForEach(func(_, value []byte) error {
+			ep := &endpoint.Endpoint{}
+			if err := json.Unmarshal(value, ep); err != nil {
+				return err
+			}
+			endpoints = append(endpoints, ep)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+func (s *BoltStore) PutFlattened(name, target string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(flattenedBucket).Put([]byte(name), []byte(target))
+	})
+}
+
+func (s *BoltStore) DeleteFlattened(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(flattenedBucket).Delete([]byte(name))
+	})
+}
+
+func (s *BoltStore) ListFlattened() (map[string]string, error) {
+	flattened := make(map[string]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(flattenedBucket).ForEach(func(name, target []byte) error {
+			flattened[string(name)] = string(target)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flattened, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
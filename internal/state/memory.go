@@ -0,0 +1,127 @@
+package state
+
+import (
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// MemoryStore is a Store which keeps the entries in memory only, it is meant for tests
+type MemoryStore struct {
+	mu        sync.RWMutex
+	entries   map[string]Entry
+	desired   map[string]*endpoint.Endpoint
+	flattened map[string]string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]Entry),
+		desired:   make(map[string]*endpoint.Endpoint),
+		flattened: make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Put(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.RecordID] = entry
+	return nil
+}
+
+func (s *MemoryStore) Get(recordID string) (*Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[recordID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &entry, nil
+}
+
+func (s *MemoryStore) Delete(recordID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, recordID)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *MemoryStore) PutDesired(key string, ep *endpoint.Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.desired[key] = ep
+	return nil
+}
+
+func (s *MemoryStore) DeleteDesired(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.desired, key)
+	return nil
+}
+
+func (s *MemoryStore) ListDesired() ([]*endpoint.Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.desired))
+	for key := range s.desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	endpoints := make([]*endpoint.Endpoint, 0, len(keys))
+	for _, key := range keys {
+		endpoints = append(endpoints, s.desired[key])
+	}
+	return endpoints, nil
+}
+
+func (s *MemoryStore) PutFlattened(name, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flattened[name] = target
+	return nil
+}
+
+func (s *MemoryStore) DeleteFlattened(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.flattened, name)
+	return nil
+}
+
+func (s *MemoryStore) ListFlattened() (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flattened := make(map[string]string, len(s.flattened))
+	for name, target := range s.flattened {
+		flattened[name] = target
+	}
+	return flattened, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sortEntries sorts by creation time, entries created at the same time by record identifier
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].RecordID < entries[j].RecordID
+	})
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ErrNotFound is returned if the store holds no entry for a record identifier
+var ErrNotFound = errors.New("state entry not found")
+
+// Entry describes a record the webhook created at Anexia
+type Entry struct {
+	RecordID  string             `json:"recordId"`
+	ZoneName  string             `json:"zoneName"`
+	Name      string             `json:"name"`
+	Type      string             `json:"type"`
+	RData     string             `json:"rdata"`
+	TTL       int                `json:"ttl"`
+	Endpoint  *endpoint.Endpoint `json:"endpoint"`
+	CreatedAt time.Time          `json:"createdAt"`
+	PlanHash  string             `json:"planHash"`
+}
+
+// Store keeps track of the records created by the webhook, entries are keyed by the Anexia record identifier. It
+// also keeps the last applied endpoints, which drift detection compares with the records at Anexia, and the apexes
+// whose CNAME is flattened to addresses.
+type Store interface {
+	// Put adds or replaces the entry for its record identifier
+	Put(entry Entry) error
+	// Get returns the entry of the record identifier, or ErrNotFound
+	Get(recordID string) (*Entry, error)
+	// Delete removes the entry of the record identifier, deleting an unknown identifier is no error
+	Delete(recordID string) error
+	// List returns all entries sorted by creation time
+	List() ([]Entry, error)
+	// PutDesired adds or replaces the last applied endpoint with the given key
+	PutDesired(key string, ep *endpoint.Endpoint) error
+	// DeleteDesired removes the last applied endpoint with the given key, deleting an unknown key is no error
+	DeleteDesired(key string) error
+	// ListDesired returns all last applied endpoints sorted by key
+	ListDesired() ([]*endpoint.Endpoint, error)
+	// PutFlattened adds or replaces the CNAME target the apex with the given name is flattened to
+	PutFlattened(name, target string) error
+	// DeleteFlattened removes the flattened apex with the given name, deleting an unknown name is no error
+	DeleteFlattened(name string) error
+	// ListFlattened returns the CNAME targets of all flattened apexes by name
+	ListFlattened() (map[string]string, error)
+	// Close releases the resources of the store
+	Close() error
+}
+
+const (
+	// TypeBolt keeps the state in a local BoltDB file
+	TypeBolt = "bolt"
+	// TypeMemory keeps the state in memory, it is lost on restart
+	TypeMemory = "memory"
+)
+
+// New creates a store of the given type, the path is only used by file based stores and required for them
+func New(storeType, path string) (Store, error) {
+	switch storeType {
+	case TypeBolt:
+		if path == "" {
+			return nil, errors.New("the bolt state store requires a path")
+		}
+		return NewBoltStore(path)
+	case TypeMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported state store type '%s'", storeType)
+	}
+}
@@ -0,0 +1,176 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		TypeMemory: func(_ *testing.T) Store {
+			return NewMemoryStore()
+		},
+		TypeBolt: func(t *testing.T) Store {
+			store, err := New(TypeBolt, filepath.Join(t.TempDir(), "state", "state.db"))
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first := Entry{
+		RecordID:  "b",
+		ZoneName:  "a.de",
+		Name:      "www",
+		Type:      "A",
+		RData:     "1.1.1.1",
+		TTL:       300,
+		Endpoint:  endpoint.NewEndpointWithTTL("www.a.de", "A", 300, "1.1.1.1"),
+		CreatedAt: createdAt,
+		PlanHash:  "hash1",
+	}
+	second := first
+	second.RecordID = "a"
+	second.RData = "2.2.2.2"
+	second.CreatedAt = createdAt.Add(time.Minute)
+	second.PlanHash = "hash2"
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+
+			_, err := store.Get("a")
+			require.ErrorIs(t, err, ErrNotFound)
+
+			require.NoError(t, store.Put(second))
+			require.NoError(t, store.Put(first))
+
+			entry, err := store.Get("b")
+			require.NoError(t, err)
+			assert.Equal(t, first.RData, entry.RData)
+			assert.Equal(t, first.PlanHash, entry.PlanHash)
+			assert.True(t, first.CreatedAt.Equal(entry.CreatedAt))
+			assert.Equal(t, first.Endpoint.DNSName, entry.Endpoint.DNSName)
+
+			entries, err := store.List()
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, "b", entries[0].RecordID, "entries are sorted by creation time")
+			assert.Equal(t, "a", entries[1].RecordID)
+
+			require.NoError(t, store.Delete("b"))
+			require.NoError(t, store.Delete("unknown"))
+			entries, err = store.List()
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "a", entries[0].RecordID)
+		})
+	}
+}
+
+func TestStoresDesired(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		TypeMemory: func(_ *testing.T) Store {
+			return NewMemoryStore()
+		},
+		TypeBolt: func(t *testing.T) Store {
+			store, err := New(TypeBolt, filepath.Join(t.TempDir(), "state.db"))
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+
+			require.NoError(t, store.PutDesired("b.de|A|", endpoint.NewEndpointWithTTL("b.de", "A", 300, "2.2.2.2")))
+			require.NoError(t, store.PutDesired("a.de|A|", endpoint.NewEndpointWithTTL("a.de", "A", 300, "1.1.1.1")))
+			require.NoError(t, store.PutDesired("a.de|A|", endpoint.NewEndpointWithTTL("a.de", "A", 600, "4.4.4.4")))
+
+			desired, err := store.ListDesired()
+			require.NoError(t, err)
+			require.Len(t, desired, 2)
+			assert.Equal(t, "a.de", desired[0].DNSName, "endpoints are sorted by key")
+			assert.Equal(t, endpoint.TTL(600), desired[0].RecordTTL)
+			assert.Equal(t, endpoint.Targets{"4.4.4.4"}, desired[0].Targets)
+			assert.Equal(t, "b.de", desired[1].DNSName)
+
+			require.NoError(t, store.DeleteDesired("b.de|A|"))
+			require.NoError(t, store.DeleteDesired("unknown"))
+			desired, err = store.ListDesired()
+			require.NoError(t, err)
+			require.Len(t, desired, 1)
+
+			entries, err := store.List()
+			require.NoError(t, err)
+			assert.Empty(t, entries, "desired endpoints are kept apart from the record entries")
+		})
+	}
+}
+
+func TestStoresFlattened(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		TypeMemory: func(_ *testing.T) Store {
+			return NewMemoryStore()
+		},
+		TypeBolt: func(t *testing.T) Store {
+			store, err := New(TypeBolt, filepath.Join(t.TempDir(), "state.db"))
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+
+			require.NoError(t, store.PutFlattened("a.de", "lb.example.net"))
+			require.NoError(t, store.PutFlattened("b.de", "other.example.net"))
+			require.NoError(t, store.PutFlattened("a.de", "lb-2.example.net"))
+			require.NoError(t, store.DeleteFlattened("b.de"))
+			require.NoError(t, store.DeleteFlattened("unknown"))
+
+			flattened, err := store.ListFlattened()
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a.de": "lb-2.example.net"}, flattened)
+		})
+	}
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := NewBoltStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(Entry{RecordID: "a", ZoneName: "a.de"}))
+	require.NoError(t, store.PutFlattened("a.de", "lb.example.net"))
+	require.NoError(t, store.Close())
+
+	reopened, err := NewBoltStore(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	entry, err := reopened.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a.de", entry.ZoneName)
+	flattened, err := reopened.ListFlattened()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a.de": "lb.example.net"}, flattened)
+}
+
+func TestNewBoltStoreRequiresPath(t *testing.T) {
+	_, err := New(TypeBolt, "")
+	assert.EqualError(t, err, "the bolt state store requires a path")
+}
+
+func TestNewUnsupportedType(t *testing.T) {
+	_, err := New("sqlite", "")
+	assert.EqualError(t, err, "unsupported state store type 'sqlite'")
+}
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/probstenhias/external-dns-anexia-webhook/internal/anexia"
+)
+
+const (
+	contentTypeZoneFile = "text/dns"
+	contentTypeJSON     = "application/json"
+)
+
+// ZoneExporter is implemented by providers which can export their zones as RFC 1035 zone files
+type ZoneExporter interface {
+	ExportZones(ctx context.Context, w io.Writer, zoneNames ...string) error
+}
+
+// DriftReporter is implemented by providers which compare the applied state with the actual records
+type DriftReporter interface {
+	// DriftReport returns the last drift report, or nil if no check has run yet
+	DriftReport() (report any, enabled bool)
+}
+
+// ZoneResolver is implemented by providers which can explain in which zone the records of a name are published
+type ZoneResolver interface {
+	// ResolveZone returns an error wrapping anexia.ErrInvalidName if the name is no valid domain name
+	ResolveZone(ctx context.Context, name string) (any, error)
+}
+
+// ExportZones handles the get request for exporting zones, the zones are selected with 'zone' query parameters
+func (p *Webhook) ExportZones(w http.ResponseWriter, r *http.Request) {
+	exporter, ok := p.provider.(ZoneExporter)
+	if !ok {
+		p.adminError(w, r, http.StatusNotImplemented, fmt.Errorf("provider does not support exporting zones"))
+		return
+	}
+
+	requestLog(r).Debug("requesting zone export")
+	buf := &bytes.Buffer{}
+	if err := exporter.ExportZones(r.Context(), buf, r.URL.Query()["zone"]...); err != nil {
+		p.adminError(w, r, http.StatusInternalServerError, fmt.Errorf("error exporting zones: %w", err))
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeZoneFile)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error writing response")
+	}
+}
+
+// DriftReport handles the get request for the result of the last drift check
+func (p *Webhook) DriftReport(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := p.provider.(DriftReporter)
+	if !ok {
+		p.adminError(w, r, http.StatusNotImplemented, fmt.Errorf("provider does not support drift detection"))
+		return
+	}
+	report, enabled := reporter.DriftReport()
+	if !enabled {
+		p.adminError(w, r, http.StatusNotFound, fmt.Errorf("drift detection is not enabled"))
+		return
+	}
+	if report == nil {
+		p.adminError(w, r, http.StatusServiceUnavailable, fmt.Errorf("no drift check has run yet"))
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error encoding drift report")
+	}
+}
+
+// ResolveZone handles the get request explaining the zone of the name given with the 'name' query parameter
+func (p *Webhook) ResolveZone(w http.ResponseWriter, r *http.Request) {
+	resolver, ok := p.provider.(ZoneResolver)
+	if !ok {
+		p.adminError(w, r, http.StatusNotImplemented, fmt.Errorf("provider does not support resolving zones"))
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		p.adminError(w, r, http.StatusBadRequest, fmt.Errorf("the query parameter 'name' is missing"))
+		return
+	}
+
+	requestLog(r).Debugf("requesting the zone of %s", name)
+	resolution, err := resolver.ResolveZone(r.Context(), name)
+	if errors.Is(err, anexia.ErrInvalidName) {
+		p.adminError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		p.adminError(w, r, http.StatusInternalServerError, fmt.Errorf("error resolving the zone of %s: %w", name, err))
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(resolution); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error encoding zone resolution")
+	}
+}
+
+// adminError writes the error as plain text response, the admin endpoints are meant to be used by humans
+func (p *Webhook) adminError(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	requestLog(r).WithField(logFieldError, err).Error("admin request failed")
+	w.Header().Set(contentTypeHeader, contentTypePlaintext)
+	w.WriteHeader(statusCode)
+	if _, writeErr := fmt.Fprint(w, err.Error()); writeErr != nil {
+		requestLog(r).WithField(logFieldError, writeErr).Error("error writing error message to response writer")
+	}
+}
@@ -28,6 +28,12 @@ type Webhook struct {
 	provider provider.Provider
 }
 
+// NegotiationHeaders is implemented by providers which advertise their effective configuration with headers of the
+// negotiation response, external-dns only reads the domain filter from its body
+type NegotiationHeaders interface {
+	NegotiationHeaders() map[string]string
+}
+
 // New creates a new instance of the Webhook
 func New(provider provider.Provider) *Webhook {
 	p := Webhook{provider: provider}
@@ -215,6 +221,11 @@ func (p *Webhook) Negotiate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if negotiator, ok := p.provider.(NegotiationHeaders); ok {
+		for name, value := range negotiator.NegotiationHeaders() {
+			w.Header().Set(name, value)
+		}
+	}
 	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
 	if _, writeError := w.Write(b); writeError != nil {
 		requestLog(r).WithField(logFieldError, writeError).Error("error writing response")